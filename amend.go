@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+const amendPrompt = `
+
+# 修正対象のコミット
+
+以下は修正（amend）するコミットの現在のメッセージである。入力データはこのコミットの変更と新たにステージされた変更を合わせたものなので、両方を踏まえてメッセージを更新すること。
+
+`
+
+// headMessage returns the message of the commit that -amend replaces.
+func (g *CommitMessageGenerator) headMessage() (string, error) {
+	head, err := g.repo.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return "", fmt.Errorf("nothing to amend: no commits yet")
+	}
+	if err != nil {
+		return "", fmt.Errorf("getting HEAD: %w", err)
+	}
+
+	commit, err := g.repo.CommitObject(head.Hash())
+	if err != nil {
+		return "", fmt.Errorf("getting commit object: %w", err)
+	}
+
+	return strings.TrimSpace(commit.Message), nil
+}
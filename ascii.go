@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/width"
+)
+
+// asciiPunctuation spells out the non-ASCII punctuation models like to use.
+var asciiPunctuation = strings.NewReplacer(
+	"‘", "'", "’", "'", "‚", "'", "′", "'",
+	"“", `"`, "”", `"`, "„", `"`, "″", `"`,
+	"«", `"`, "»", `"`, "「", `"`, "」", `"`, "『", `"`, "』", `"`,
+	"‐", "-", "‑", "-", "‒", "-", "–", "-", "—", "--", "―", "--", "−", "-",
+	"…", "...", "⋯", "...",
+	"•", "*", "·", "*", "・", "*",
+	"→", "->", "←", "<-", "⇒", "=>", "↔", "<->",
+	" ", " ", " ", " ", " ", " ", "　", " ",
+	"。", ". ", "、", ", ", "【", "[", "】", "]", "〜", "~",
+	"≤", "<=", "≥", ">=", "≠", "!=", "×", "x",
+)
+
+// asciiOnly replaces non-ASCII punctuation in message with its ASCII
+// equivalent and drops emoji and other symbols, for tooling that cannot
+// handle them. Letters, such as Japanese text, are kept.
+func asciiOnly(message string) string {
+	message = width.Fold.String(asciiPunctuation.Replace(message))
+
+	lines := strings.Split(message, "\n")
+	for i, line := range lines {
+		var b strings.Builder
+		dropped := false
+		for _, r := range line {
+			if r > unicode.MaxASCII && !unicode.IsLetter(r) && !unicode.IsDigit(r) && (!unicode.Is(unicode.M, r) || isEmojiModifier(r)) {
+				dropped = true
+				continue
+			}
+			// Don't leave the space that separated a dropped emoji.
+			if dropped && r == ' ' && (b.Len() == 0 || strings.HasSuffix(b.String(), " ")) {
+				continue
+			}
+			dropped = false
+			b.WriteRune(r)
+		}
+		lines[i] = strings.TrimRight(b.String(), " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// isEmojiModifier reports whether r only changes how the preceding emoji
+// is drawn: variation selectors and the combining keycap.
+func isEmojiModifier(r rune) bool {
+	return r >= 0xfe00 && r <= 0xfe0f || r == 0x20e3
+}
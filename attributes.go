@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
+)
+
+// loadAttributes reads the .gitattributes files of the worktree together
+// with the global and system attribute files configured in gitconfig.
+// Bare repositories have no worktree to read, so only the latter apply.
+func loadAttributes(worktree *git.Worktree) (gitattributes.Matcher, error) {
+	root := osfs.New("/")
+
+	var stack []gitattributes.MatchAttribute
+	for _, load := range []func() ([]gitattributes.MatchAttribute, error){
+		func() ([]gitattributes.MatchAttribute, error) { return gitattributes.LoadSystemPatterns(root) },
+		func() ([]gitattributes.MatchAttribute, error) { return gitattributes.LoadGlobalPatterns(root) },
+		func() ([]gitattributes.MatchAttribute, error) {
+			if worktree == nil {
+				return nil, nil
+			}
+			return gitattributes.ReadPatterns(worktree.Filesystem, nil)
+		},
+	} {
+		attrs, err := load()
+		if err != nil {
+			return nil, fmt.Errorf("reading gitattributes: %w", err)
+		}
+		stack = append(stack, attrs...)
+	}
+
+	return gitattributes.NewMatcher(stack), nil
+}
+
+// diffDisabled reports whether .gitattributes marks the file as binary or
+// turns off textual diffs for it (`binary`, `-diff` or `-text`).
+func (g *CommitMessageGenerator) diffDisabled(filePath string) bool {
+	if g.attributes == nil {
+		return false
+	}
+
+	attrs, _ := g.attributes.Match(strings.Split(filePath, "/"), []string{"binary", "diff", "text"})
+	if attr, ok := attrs["binary"]; ok && attr.IsSet() {
+		return true
+	}
+	if attr, ok := attrs["diff"]; ok && attr.IsUnset() {
+		return true
+	}
+	if attr, ok := attrs["text"]; ok && attr.IsUnset() {
+		return true
+	}
+	return false
+}
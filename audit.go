@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// auditLog records every request sent to a provider, and what came back,
+// in a JSON Lines file given with -audit-log. The file is only ever
+// appended to. A nil *auditLog records nothing.
+type auditLog struct {
+	path string
+}
+
+// auditEntry is one line of the audit log. A "request" entry is written
+// before anything is sent and holds the prompt exactly as sent, after
+// -redact and -never-send; the "response" entry with the same ID holds
+// the answers or the error.
+type auditEntry struct {
+	Time     time.Time `json:"time"`
+	ID       string    `json:"id"`
+	Event    string    `json:"event"` // request or response
+	Provider string    `json:"provider"`
+	Model    string    `json:"model"`
+	Endpoint string    `json:"endpoint,omitempty"`
+	System   string    `json:"system,omitempty"`
+	User     string    `json:"user,omitempty"`
+	Messages []string  `json:"messages,omitempty"`
+	Usage    *Usage    `json:"usage,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// newAuditLog returns the audit log at path, or nil when path is empty.
+// A leading ~/ stands for the home directory.
+func newAuditLog(path string) *auditLog {
+	if path == "" {
+		return nil
+	}
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, rest)
+		}
+	}
+	return &auditLog{path: path}
+}
+
+// check makes sure the log can be appended to, creating it if needed, so
+// that a bad -audit-log fails before anything is sent.
+func (a *auditLog) check() error {
+	if a == nil {
+		return nil
+	}
+	f, err := a.open()
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (a *auditLog) open() (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(a.path), 0o700); err != nil {
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+	f, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+	return f, nil
+}
+
+func (a *auditLog) append(entry auditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("writing audit log: %w", err)
+	}
+	f, err := a.open()
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("writing audit log: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing audit log: %w", err)
+	}
+	return nil
+}
+
+// request records req as about to be sent to p and returns the ID that
+// ties it to its response. The request must not be sent if this fails.
+func (a *auditLog) request(p Provider, req GenerateRequest) (string, error) {
+	if a == nil {
+		return "", nil
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("writing audit log: %w", err)
+	}
+	id := hex.EncodeToString(b)
+	entry := auditEntry{
+		Time:     time.Now().UTC(),
+		ID:       id,
+		Event:    "request",
+		Provider: p.Name(),
+		Model:    p.Model(),
+		System:   req.System,
+		User:     req.User,
+	}
+	if e, ok := p.(endpointProvider); ok {
+		entry.Endpoint = e.Endpoint()
+	}
+	return id, a.append(entry)
+}
+
+// response records what p returned for the request with the given ID.
+// The request has already been sent, so a failure is only logged.
+func (a *auditLog) response(id string, p Provider, resp GenerateResponse, err error) {
+	if a == nil {
+		return
+	}
+	entry := auditEntry{
+		Time:     time.Now().UTC(),
+		ID:       id,
+		Event:    "response",
+		Provider: p.Name(),
+		Model:    p.Model(),
+		Usage:    resp.Usage,
+	}
+	if resp.Content != "" {
+		entry.Messages = append([]string{resp.Content}, resp.Alternatives...)
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if err := a.append(entry); err != nil {
+		fmt.Fprintf(notices, "Warning: %v\n", err)
+	}
+}
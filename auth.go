@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/zalando/go-keyring"
+)
+
+const keyringService = "autogcm"
+
+// providerKeyEnvs maps provider names to the environment variable holding
+// their API key.
+var providerKeyEnvs = map[string]string{
+	"groq":   "GROQ_API_KEY",
+	"openai": "OPENAI_API_KEY",
+}
+
+// keyringGet reads the stored API key for provider from the OS keychain
+// (macOS Keychain, Windows Credential Manager or Secret Service). A missing
+// entry or unavailable keychain yields "".
+func keyringGet(provider string) string {
+	key, err := keyring.Get(keyringService, provider)
+	if err != nil {
+		return ""
+	}
+	return key
+}
+
+// runAuthCommand implements `autogcm auth set|remove <provider>`.
+func runAuthCommand(args []string, in io.Reader, out io.Writer) error {
+	if len(args) != 2 {
+		return errors.New("usage: autogcm auth set|remove <provider>")
+	}
+	action, provider := args[0], args[1]
+	if _, ok := providerKeyEnvs[provider]; !ok {
+		return fmt.Errorf("unknown provider %q", provider)
+	}
+
+	switch action {
+	case "set":
+		key, err := readSecret(bufio.NewReader(in), in, out, fmt.Sprintf("Enter API key for %s: ", provider))
+		if err != nil {
+			return err
+		}
+		if key == "" {
+			return errors.New("no key entered")
+		}
+		if err := keyring.Set(keyringService, provider, key); err != nil {
+			return fmt.Errorf("storing key in keychain: %w", err)
+		}
+		fmt.Fprintf(out, "Stored %s API key in the OS keychain.\n", provider)
+	case "remove":
+		if err := keyring.Delete(keyringService, provider); err != nil {
+			if errors.Is(err, keyring.ErrNotFound) {
+				return fmt.Errorf("no stored key for %s", provider)
+			}
+			return fmt.Errorf("removing key from keychain: %w", err)
+		}
+		fmt.Fprintf(out, "Removed %s API key from the OS keychain.\n", provider)
+	default:
+		return fmt.Errorf("unknown auth command %q", action)
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+)
+
+// emptyTree is the hash git uses for a tree with no entries, for diffing
+// against "no commit".
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+const (
+	backendGoGit = "go-git" // Built-in diff using go-git and difflib
+	backendExec  = "git"    // Shell out to the git binary
+)
+
+// defaultBackend is the -backend default, taken from AUTOGCM_BACKEND.
+func defaultBackend() string {
+	if backend := os.Getenv("AUTOGCM_BACKEND"); backend != "" {
+		return backend
+	}
+	return backendGoGit
+}
+
+// getGitDiff collects the patches from the changes `git diff` finds, which
+// is faster on large repositories, reads sparse and temporary indexes and
+// reports renames and mode changes exactly as git does. The files are then
+// rendered like those of the built-in backend.
+func (g *CommitMessageGenerator) getGitDiff() ([]FilePatch, error) {
+	changes, err := g.gitChanges()
+	if err != nil {
+		return nil, err
+	}
+	return g.renderChanges(changes)
+}
+
+// changes lists the changes to be committed with the configured backend.
+func (g *CommitMessageGenerator) changes() ([]fileChange, error) {
+	if g.options.Backend == backendExec {
+		return g.gitChanges()
+	}
+	return g.stagedChanges()
+}
+
+// gitChanges lists the changes with `git diff --raw`, sorted by path.
+// Files whose new side is only in the worktree (-all) are read into
+// worktreeBlobs under their blob hash.
+func (g *CommitMessageGenerator) gitChanges() ([]fileChange, error) {
+	args := []string{"diff", "--raw", "-z", "--no-abbrev", "--find-renames"}
+	switch {
+	case g.options.treeMode():
+		args = append(args, g.options.Base, g.options.Head)
+	case g.options.Amend:
+		args = append(args, "--cached", g.parentOfHead())
+	case g.options.All:
+		args = append(args, g.headOrEmptyTree())
+	default:
+		args = append(args, "--cached", g.headOrEmptyTree())
+	}
+
+	dir := g.gitDir()
+	if g.worktree != nil {
+		dir = g.worktree.Filesystem.Root()
+	}
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("running git diff: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	changes, err := parseRawDiff(out)
+	if err != nil {
+		return nil, err
+	}
+	selected := changes[:0]
+	for _, c := range changes {
+		if !g.pathspec.Match(c.Path, c.OldPath) {
+			continue
+		}
+		if c.Action != git.Deleted && c.NewHash.IsZero() && c.NewMode != filemode.Submodule {
+			if c.NewHash, err = g.readWorktreeBlob(dir, c.Path, c.NewMode); err != nil {
+				return nil, err
+			}
+		}
+		selected = append(selected, c)
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].Path < selected[j].Path })
+	return selected, nil
+}
+
+// parseRawDiff parses the output of `git diff --raw -z --no-abbrev`:
+// ":OLDMODE NEWMODE OLDHASH NEWHASH STATUS" NUL PATH NUL, with a second
+// path for renames and copies. Unmerged paths are skipped.
+func parseRawDiff(out []byte) ([]fileChange, error) {
+	fields := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	var changes []fileChange
+	for i := 0; i < len(fields) && fields[i] != ""; i++ {
+		meta := strings.Fields(strings.TrimPrefix(fields[i], ":"))
+		if len(meta) != 5 || i+1 >= len(fields) {
+			return nil, fmt.Errorf("parsing git diff --raw: unexpected %q", fields[i])
+		}
+		oldMode, err := filemode.New(meta[0])
+		if err != nil {
+			return nil, fmt.Errorf("parsing git diff --raw: %w", err)
+		}
+		newMode, err := filemode.New(meta[1])
+		if err != nil {
+			return nil, fmt.Errorf("parsing git diff --raw: %w", err)
+		}
+		c := fileChange{
+			Path:    fields[i+1],
+			OldHash: plumbing.NewHash(meta[2]),
+			NewHash: plumbing.NewHash(meta[3]),
+			OldMode: oldMode,
+			NewMode: newMode,
+		}
+		i++
+
+		status := meta[4][0]
+		if status == 'R' || status == 'C' {
+			if i+1 >= len(fields) {
+				return nil, fmt.Errorf("parsing git diff --raw: no destination for %s", c.Path)
+			}
+			i++
+			c.Path, c.OldPath = fields[i], c.Path
+		}
+		switch status {
+		case 'A':
+			c.Action = git.Added
+		case 'D':
+			c.Action = git.Deleted
+		case 'M', 'T':
+			c.Action = git.Modified
+		case 'R':
+			c.Action = git.Renamed
+		case 'C':
+			c.Action, c.OldPath, c.OldHash, c.OldMode = git.Added, "", plumbing.ZeroHash, 0
+		default:
+			continue // Unmerged or unknown
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// readWorktreeBlob reads a file from the worktree into worktreeBlobs and
+// returns the hash it has as a blob.
+func (g *CommitMessageGenerator) readWorktreeBlob(dir string, path string, mode filemode.FileMode) (plumbing.Hash, error) {
+	name := filepath.Join(dir, filepath.FromSlash(path))
+	var content []byte
+	var err error
+	if mode == filemode.Symlink {
+		var target string
+		target, err = os.Readlink(name)
+		content = []byte(target)
+	} else {
+		content, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	hash := plumbing.ComputeHash(plumbing.BlobObject, content)
+	if g.worktreeBlobs == nil {
+		g.worktreeBlobs = map[plumbing.Hash]string{}
+	}
+	g.worktreeBlobs[hash] = string(content)
+	return hash, nil
+}
+
+func (g *CommitMessageGenerator) headOrEmptyTree() string {
+	if _, err := g.repo.Head(); errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return emptyTree
+	}
+	return "HEAD"
+}
+
+func (g *CommitMessageGenerator) parentOfHead() string {
+	head, err := g.repo.Head()
+	if err != nil {
+		return emptyTree
+	}
+	commit, err := g.repo.CommitObject(head.Hash())
+	if err != nil || commit.NumParents() == 0 {
+		return emptyTree
+	}
+	return "HEAD^"
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+)
+
+func TestParseRawDiff(t *testing.T) {
+	const (
+		zero = "0000000000000000000000000000000000000000"
+		old  = "1111111111111111111111111111111111111111"
+		new  = "2222222222222222222222222222222222222222"
+	)
+	raw := func(records ...string) []byte {
+		return []byte(strings.Join(records, "\x00") + "\x00")
+	}
+
+	tests := []struct {
+		name string
+		out  []byte
+		want []fileChange
+	}{
+		{
+			name: "added",
+			out:  raw(":000000 100644 "+zero+" "+new+" A", "a.txt"),
+			want: []fileChange{{Path: "a.txt", Action: git.Added, OldHash: plumbing.ZeroHash, NewHash: plumbing.NewHash(new), NewMode: filemode.Regular}},
+		},
+		{
+			name: "modified and deleted",
+			out:  raw(":100644 100755 "+old+" "+new+" M", "run.sh", ":100644 000000 "+old+" "+zero+" D", "gone.txt"),
+			want: []fileChange{
+				{Path: "run.sh", Action: git.Modified, OldHash: plumbing.NewHash(old), NewHash: plumbing.NewHash(new), OldMode: filemode.Regular, NewMode: filemode.Executable},
+				{Path: "gone.txt", Action: git.Deleted, OldHash: plumbing.NewHash(old), NewHash: plumbing.ZeroHash, OldMode: filemode.Regular},
+			},
+		},
+		{
+			name: "renamed",
+			out:  raw(":100644 100644 "+old+" "+old+" R100", "old name.go", "new name.go"),
+			want: []fileChange{{Path: "new name.go", OldPath: "old name.go", Action: git.Renamed, OldHash: plumbing.NewHash(old), NewHash: plumbing.NewHash(old), OldMode: filemode.Regular, NewMode: filemode.Regular}},
+		},
+		{
+			name: "copied is added",
+			out:  raw(":100644 100644 "+old+" "+old+" C75", "a.go", "b.go"),
+			want: []fileChange{{Path: "b.go", Action: git.Added, NewHash: plumbing.NewHash(old), NewMode: filemode.Regular}},
+		},
+		{
+			name: "unmerged is skipped",
+			out:  raw(":000000 000000 "+zero+" "+zero+" U", "conflict.go", ":000000 100644 "+zero+" "+new+" A", "a.txt"),
+			want: []fileChange{{Path: "a.txt", Action: git.Added, NewHash: plumbing.NewHash(new), NewMode: filemode.Regular}},
+		},
+		{
+			name: "empty",
+			out:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRawDiff(tt.out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRawDiffErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+	}{
+		{"short record", ":100644 100644 M\x00a.txt\x00"},
+		{"missing path", ":100644 100644 " + strings.Repeat("1", 40) + " " + strings.Repeat("2", 40) + " M\x00"},
+		{"missing rename destination", ":100644 100644 " + strings.Repeat("1", 40) + " " + strings.Repeat("1", 40) + " R100\x00a.txt\x00"},
+		{"bad mode", ":1x0644 100644 " + strings.Repeat("1", 40) + " " + strings.Repeat("2", 40) + " M\x00a.txt\x00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := parseRawDiff([]byte(tt.out)); err == nil {
+				t.Errorf("got %+v, want an error", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// How the ticket found in the branch name ends up in the message.
+const (
+	ticketContext = "context" // Only told to the model, which may mention it
+	ticketSubject = "subject" // Prefixed to the subject line
+	ticketFooter  = "footer"  // Added as a "Refs:" or "Closes:" trailer
+	ticketOff     = "off"     // Not extracted at all
+)
+
+func defaultTicketMode() string {
+	if mode := os.Getenv("AUTOGCM_TICKET"); mode != "" {
+		return mode
+	}
+	return ticketFooter
+}
+
+func defaultTicketPattern() string {
+	return os.Getenv("AUTOGCM_TICKET_PATTERN")
+}
+
+const branchPrompt = `
+
+# ブランチ
+
+コミット先のブランチは %s である。ブランチ名は変更の目的やスコープを判断する手がかりとして使うこと。
+`
+
+const ticketPrompt = `関連するチケットは %s である。本文で触れてもよいが、チケットの内容を推測で書かないこと。
+`
+
+const ticketInjectedPrompt = `関連するチケットは %s である。チケット番号はツールが自動で付けるので、メッセージには書かないこと。
+`
+
+var (
+	// jiraTicket matches upper-case keys such as JIRA-123 anywhere in a
+	// branch name; lower-case ones are too easily confused with words.
+	jiraTicket = regexp.MustCompile(`(?:^|[^A-Za-z0-9])([A-Z][A-Z0-9]+-[0-9]+)(?:$|[^A-Za-z0-9.])`)
+	// issueNumber matches "#456" or a number introduced as an issue, as in
+	// "issue-456-crash" or "issues/456". Bare numbers such as the year in
+	// "fix/2024-cleanup" are left to -ticket-pattern.
+	issueNumber = regexp.MustCompile(`#([0-9]+)|(?:^|/)issues?[-_/]([0-9]+)(?:$|[-_/])`)
+)
+
+// parseTicketPattern compiles a -ticket-pattern, which must capture the
+// ticket in its first group.
+func parseTicketPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("parsing -ticket-pattern: %w", err)
+	}
+	if re.NumSubexp() < 1 {
+		return nil, fmt.Errorf("-ticket-pattern %q has no capturing group for the ticket", pattern)
+	}
+	return re, nil
+}
+
+// ticketFromBranch extracts the ticket a branch is named after: a Jira
+// style key or a "#N" issue reference. A custom pattern replaces the
+// built-in ones; a captured number is taken as an issue number.
+func ticketFromBranch(branch string, pattern *regexp.Regexp) string {
+	if pattern != nil {
+		m := pattern.FindStringSubmatch(branch)
+		if m == nil || m[1] == "" {
+			return ""
+		}
+		ticket := strings.TrimPrefix(m[1], "#")
+		if isIssueNumber(ticket) {
+			return "#" + ticket
+		}
+		return m[1]
+	}
+	if m := jiraTicket.FindStringSubmatch(branch); m != nil {
+		return m[1]
+	}
+	if m := issueNumber.FindStringSubmatch(branch); m != nil {
+		if m[1] != "" {
+			return "#" + m[1]
+		}
+		return "#" + m[2]
+	}
+	return ""
+}
+
+// currentBranch returns the short name of the checked out branch, or ""
+// on a detached HEAD.
+func (g *CommitMessageGenerator) currentBranch() (string, error) {
+	if g.repo == nil {
+		return "", nil
+	}
+	head, err := g.repo.Reference(plumbing.HEAD, false)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("getting HEAD: %w", err)
+	}
+	if head.Type() != plumbing.SymbolicReference || !head.Target().IsBranch() {
+		return "", nil
+	}
+	return head.Target().Short(), nil
+}
+
+// branchContext tells the model the branch being committed to and the
+// ticket it refers to.
+func (g *CommitMessageGenerator) branchContext(branch string) string {
+	context := fmt.Sprintf(branchPrompt, branch)
+	switch {
+	case g.ticket == "":
+	case g.options.Ticket == ticketContext:
+		context += fmt.Sprintf(ticketPrompt, g.ticket)
+	default:
+		context += fmt.Sprintf(ticketInjectedPrompt, g.ticket)
+	}
+	return context
+}
+
+func isIssueNumber(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
+
+// ticketFooterLine links the message to a ticket with a trailer:
+// "Closes: #N" closes an issue when the commit reaches the default branch,
+// other tickets get "Refs: KEY".
+func ticketFooterLine(ticket string) string {
+	if strings.HasPrefix(ticket, "#") {
+		return "Closes: " + ticket
+	}
+	return "Refs: " + ticket
+}
+
+// injectTicket adds the ticket to the subject or as a footer, unless the
+// message already mentions it.
+func injectTicket(message string, ticket string, mode string) string {
+	if ticket == "" || strings.Contains(message, ticket) {
+		return message
+	}
+	switch mode {
+	case ticketSubject:
+		// Keep a Conventional Commits header parseable: "feat: JIRA-1 ...".
+		if m := conventionalHeader.FindStringSubmatchIndex(message); m != nil {
+			return message[:m[10]] + ticket + " " + message[m[10]:]
+		}
+		return ticket + " " + message
+	case ticketFooter:
+		return strings.TrimRight(message, "\n") + "\n\n" + ticketFooterLine(ticket)
+	}
+	return message
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestTicketFromBranch(t *testing.T) {
+	custom := regexp.MustCompile(`^(?:feature|fix)/([A-Z]+-[0-9]+|[0-9]+)-`)
+	tests := []struct {
+		branch  string
+		pattern *regexp.Regexp
+		want    string
+	}{
+		{"feature/PROJ-123-login", nil, "PROJ-123"},
+		{"fix/#456", nil, "#456"},
+		{"issue-456-crash", nil, "#456"},
+		{"fix/issues/456", nil, "#456"},
+		{"fix/2024-cleanup", nil, ""},
+		{"release/1-2", nil, ""},
+		{"feature/v1.2-ui", nil, ""},
+		{"fix/456-crash", custom, "#456"},
+		{"feature/PROJ-7-x", custom, "PROJ-7"},
+		{"main", custom, ""},
+	}
+	for _, tt := range tests {
+		if got := ticketFromBranch(tt.branch, tt.pattern); got != tt.want {
+			t.Errorf("ticketFromBranch(%q) = %q, want %q", tt.branch, got, tt.want)
+		}
+	}
+}
+
+func TestInjectTicket(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		ticket  string
+		mode    string
+		want    string
+	}{
+		{"issue footer", "fix: crash on start\n", "#456", ticketFooter, "fix: crash on start\n\nCloses: #456"},
+		{"key footer", "fix: crash on start", "PROJ-1", ticketFooter, "fix: crash on start\n\nRefs: PROJ-1"},
+		{"already mentioned", "fix: crash on start\n\nRefs: PROJ-1", "PROJ-1", ticketFooter, "fix: crash on start\n\nRefs: PROJ-1"},
+		{"conventional subject", "fix(api): crash on start", "PROJ-1", ticketSubject, "fix(api): PROJ-1 crash on start"},
+		{"plain subject", "Fix crash on start", "PROJ-1", ticketSubject, "PROJ-1 Fix crash on start"},
+		{"context", "fix: crash on start", "PROJ-1", ticketContext, "fix: crash on start"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := injectTicket(tt.message, tt.ticket, tt.mode); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
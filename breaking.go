@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const maxBreakingChanges = 10 // Breaking changes listed in the prompt
+
+const breakingPrompt = `
+
+# 互換性のない変更
+
+差分から次の互換性のない変更が見つかった。本文の最後に ` + "`BREAKING CHANGE: `" + ` で始まるフッターを付け、何が使えなくなったか、利用者がどう移行すればよいかを書くこと。%s
+
+%s`
+
+const breakingConventionalPrompt = "Conventional Commits の1行目では type(scope) の直後に ! を付けること。"
+
+var (
+	// goTopLevelDecl matches the first line of a top-level function, method
+	// or type declaration.
+	goTopLevelDecl = regexp.MustCompile(`^(?:func\s+(?:\(\s*(?:\w+\s+)?\*?\s*(\w+)[^)]*\)\s*)?(\w+)|type\s+(\w+))`)
+	// configKey matches a key in JSON, YAML, TOML, INI or .env files.
+	configKey = regexp.MustCompile(`^\s*["']?([A-Za-z_][\w.-]*)["']?\s*[:=]`)
+)
+
+// dependencyManifests list packages under keys whose removal is not a
+// breaking change of the project itself.
+var dependencyManifests = map[string]bool{
+	"package.json": true, "composer.json": true, "Cargo.toml": true, "pyproject.toml": true,
+}
+
+// detectBreakingChanges looks for removed or changed exported Go
+// declarations and removed configuration keys.
+func detectBreakingChanges(patches []FilePatch) []string {
+	var found []string
+	for _, p := range patches {
+		if p.Excluded {
+			continue
+		}
+		ext := strings.ToLower(path.Ext(p.Path))
+		switch {
+		case ext == ".go" && !strings.HasSuffix(p.Path, "_test.go") && !isInternalPackage(p.Path):
+			found = append(found, goBreakingChanges(p)...)
+		case (configExtensions[ext] || path.Base(p.Path) == ".env") && !dependencyManifests[path.Base(p.Path)]:
+			found = append(found, removedConfigKeys(p)...)
+		}
+	}
+	sort.Strings(found)
+	return found
+}
+
+func isInternalPackage(filePath string) bool {
+	return strings.HasPrefix(filePath, "internal/") || strings.Contains(filePath, "/internal/")
+}
+
+// changedLines returns the removed and added lines of a patch, without
+// the leading - or +.
+func changedLines(patch string) ([]string, []string) {
+	var removed, added []string
+	for _, line := range strings.Split(patch, "\n") {
+		switch {
+		case strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "+++ "):
+		case strings.HasPrefix(line, "-"):
+			removed = append(removed, line[1:])
+		case strings.HasPrefix(line, "+"):
+			added = append(added, line[1:])
+		}
+	}
+	return removed, added
+}
+
+// goDeclLines maps the exported declarations starting on the given lines,
+// keyed by name ("Recv.Method" for methods), to their first line.
+func goDeclLines(lines []string) map[string]string {
+	decls := map[string]string{}
+	for _, line := range lines {
+		m := goTopLevelDecl.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		name := m[2] + m[3]
+		if !isExported(name) || (m[1] != "" && !isExported(m[1])) {
+			continue
+		}
+		if m[1] != "" {
+			name = m[1] + "." + name
+		}
+		decls[name] = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(line), "{"))
+	}
+	return decls
+}
+
+func isExported(name string) bool {
+	return name != "" && name[0] >= 'A' && name[0] <= 'Z'
+}
+
+func goBreakingChanges(p FilePatch) []string {
+	removedLines, addedLines := changedLines(p.Patch)
+	before, after := goDeclLines(removedLines), goDeclLines(addedLines)
+
+	var found []string
+	for name, old := range before {
+		switch current, ok := after[name]; {
+		case !ok:
+			found = append(found, fmt.Sprintf("%s: exported %s was removed or renamed", p.Path, name))
+		case current != old:
+			found = append(found, fmt.Sprintf("%s: signature of %s changed from `%s` to `%s`", p.Path, name, old, current))
+		}
+	}
+	return found
+}
+
+func removedConfigKeys(p FilePatch) []string {
+	removedLines, addedLines := changedLines(p.Patch)
+	added := map[string]bool{}
+	for _, line := range addedLines {
+		if m := configKey.FindStringSubmatch(line); m != nil {
+			added[m[1]] = true
+		}
+	}
+
+	var found []string
+	seen := map[string]bool{}
+	for _, line := range removedLines {
+		m := configKey.FindStringSubmatch(line)
+		if m == nil || added[m[1]] || seen[m[1]] {
+			continue
+		}
+		seen[m[1]] = true
+		found = append(found, fmt.Sprintf("%s: configuration key %s was removed", p.Path, m[1]))
+	}
+	return found
+}
+
+// breakingContext asks for a BREAKING CHANGE footer listing what was found.
+func breakingContext(found []string, conventional bool) string {
+	var list strings.Builder
+	for i, item := range found {
+		if i == maxBreakingChanges {
+			fmt.Fprintf(&list, "- ... and %d more\n", len(found)-i)
+			break
+		}
+		fmt.Fprintf(&list, "- %s\n", item)
+	}
+	var bang string
+	if conventional {
+		bang = breakingConventionalPrompt
+	}
+	return fmt.Sprintf(breakingPrompt, bang, list.String())
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// responseCacheAge is how long a cached response is kept after it was
+// last written.
+const responseCacheAge = 30 * 24 * time.Hour
+
+func responseCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("locating cache directory: %w", err)
+	}
+	return filepath.Join(dir, "autogcm", "responses"), nil
+}
+
+// responseCacheKey hashes everything that shapes a provider's answer: the
+// model, the assembled prompt and how it is sampled.
+func (g *CommitMessageGenerator) responseCacheKey(p Provider, prompt Prompt) string {
+	key, _ := json.Marshal(struct {
+		Provider, Model, System, User string
+		Sampling                      SamplingOptions
+		Structured, Conventional      bool
+		Candidates                    int
+	}{p.Name(), p.Model(), prompt.System, prompt.User, g.options.Sampling, g.options.Structured, g.options.Conventional, g.options.Candidates})
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:])
+}
+
+// cachedResult returns the result stored under key, if any. It reports no
+// usage, since no request was made.
+func cachedResult(key string) (Result, bool) {
+	dir, err := responseCacheDir()
+	if err != nil {
+		return Result{}, false
+	}
+	data, err := os.ReadFile(filepath.Join(dir, key+".json"))
+	if err != nil {
+		return Result{}, false
+	}
+	var result Result
+	if err := json.Unmarshal(data, &result); err != nil || result.Message == "" {
+		return Result{}, false
+	}
+	result.Usage = Usage{}
+	result.Cached = true
+	return result, true
+}
+
+// cacheResult stores result under key and drops entries older than
+// responseCacheAge. The cache is best effort, so failures are only logged.
+func cacheResult(key string, result Result) {
+	dir, err := responseCacheDir()
+	if err == nil {
+		err = os.MkdirAll(dir, 0o700)
+	}
+	var data []byte
+	if err == nil {
+		data, err = json.Marshal(result)
+	}
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, key+".json"), data, 0o600)
+	}
+	if err != nil {
+		debugf("caching response: %v", err)
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && time.Since(info.ModTime()) > responseCacheAge {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Candidate is one of the messages generated for the same diff.
+type Candidate struct {
+	Message    string
+	Structured *StructuredMessage
+}
+
+// decodeCandidate cleans a model answer and, with -structured, parses it.
+func (g *CommitMessageGenerator) decodeCandidate(content string) (Candidate, error) {
+	candidate := Candidate{Message: cleanMessage(content)}
+	if !g.options.Structured {
+		return candidate, nil
+	}
+
+	structured, err := parseStructuredMessage(candidate.Message)
+	if err != nil {
+		return candidate, err
+	}
+	candidate.Structured = structured
+	candidate.Message = structured.Text()
+	if g.options.Conventional {
+		candidate.Message = structured.ConventionalText()
+	}
+	return candidate, nil
+}
+
+// printCandidates writes messages numbered from 1, each under a "# N"
+// line that git strips as a comment if the output is used as is. An
+// explanation of the first message follows as comment lines too.
+func printCandidates(w io.Writer, messages []string, explanation string) {
+	for i, message := range messages {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "# %d\n%s\n", i+1, message)
+	}
+	if explanation == "" {
+		return
+	}
+	fmt.Fprintln(w, "\n# Rationale for #1:")
+	for _, line := range strings.Split(explanation, "\n") {
+		fmt.Fprintln(w, strings.TrimRight("# "+line, " "))
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+)
+
+// newRootCommand returns the autogcm command, which describes the changes
+// to the given paths, with its subcommands. The flags are defined on
+// flag.CommandLine and are accepted by every subcommand.
+func newRootCommand(options *Options, showVersion *bool) *cobra.Command {
+	root := &cobra.Command{
+		Use:   "autogcm [flags] [path...]",
+		Short: "Write a git commit message for the staged changes",
+		Args:  cobra.ArbitraryArgs,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			if *showVersion {
+				printVersion(os.Stdout)
+				os.Exit(0)
+			}
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, stop := setup(options)
+			defer stop()
+			options.Pathspecs = args
+			generate(ctx, *options)
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return nil, cobra.ShellCompDirectiveDefault
+		},
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+	}
+	root.PersistentFlags().AddFlagSet(flag.CommandLine)
+	root.CompletionOptions.DisableDefaultCmd = true
+	registerCompletions(root, options)
+
+	root.AddCommand(
+		subcommand(options, "auth set|remove <provider>", "Store or remove a provider's API key in the OS keychain",
+			func(ctx context.Context, args []string) error {
+				return runAuthCommand(args, os.Stdin, os.Stderr)
+			}),
+		subcommand(options, "doctor", "Check the repository, configuration and providers",
+			func(ctx context.Context, args []string) error {
+				return runDoctor(ctx, *options, os.Stdout)
+			}),
+		subcommand(options, "init", "Set up a provider and the configuration interactively",
+			func(ctx context.Context, args []string) error {
+				return runInit(ctx, *options, os.Stdin, os.Stderr)
+			}),
+		subcommand(options, "install-hook", "Install the prepare-commit-msg hook",
+			func(ctx context.Context, args []string) error {
+				return runHookCommand(*options, "install-hook", os.Stderr)
+			}),
+		subcommand(options, "uninstall-hook", "Remove the prepare-commit-msg hook",
+			func(ctx context.Context, args []string) error {
+				return runHookCommand(*options, "uninstall-hook", os.Stderr)
+			}),
+		subcommand(options, "prompt show|update|pin [version|embedded|none]", "Show, update or pin the system prompt",
+			func(ctx context.Context, args []string) error {
+				return runPromptCommand(ctx, *options, args, os.Stdout)
+			}),
+		subcommand(options, "stats", "Summarize the usage recorded with -metrics",
+			func(ctx context.Context, args []string) error {
+				return runStats(args, os.Stdout)
+			}),
+		&cobra.Command{
+			Use:   "hook <message-file> [source [commit]]",
+			Short: "Fill in the message from git's prepare-commit-msg hook",
+			Args:  cobra.ArbitraryArgs,
+			Run: func(cmd *cobra.Command, args []string) {
+				ctx, stop := setup(options)
+				defer stop()
+				// git runs prepare-commit-msg with the message file, the source of
+				// the message (empty when the user is to write one) and a commit.
+				if len(args) < 1 {
+					fmt.Fprintln(os.Stderr, "Usage: autogcm [flags] hook <message-file> [source [commit]]")
+					os.Exit(exitError)
+				}
+				args = append(args, "", "")
+				needed, err := hookNeedsMessage(options.Dir, args[1], args[2])
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				if !needed {
+					return
+				}
+				options.HookFile = args[0]
+				options.Pick, options.Edit, options.Copy, options.Commit, options.Push, options.DryRun = false, false, false, false, false, false
+				options.Format, options.Candidates = formatText, 1
+				generate(ctx, *options)
+			},
+		},
+		&cobra.Command{
+			Use:   "revert <commit> [path...]",
+			Short: "Write the message for reverting a commit",
+			Args:  cobra.ArbitraryArgs,
+			Run: func(cmd *cobra.Command, args []string) {
+				ctx, stop := setup(options)
+				defer stop()
+				if len(args) < 1 {
+					fmt.Fprintln(os.Stderr, "Usage: autogcm [flags] revert <commit> [path...]")
+					os.Exit(exitError)
+				}
+				// The diff from the commit to its parent is exactly what reverting it does.
+				options.Revert = args[0]
+				options.Base, options.Head = options.Revert, options.Revert+"^"
+				options.Pathspecs = args[1:]
+				generate(ctx, *options)
+			},
+		},
+		&cobra.Command{
+			Use:   "squash <base>..<head> [path...]",
+			Short: "Write one message for the commits in a range",
+			Args:  cobra.ArbitraryArgs,
+			Run: func(cmd *cobra.Command, args []string) {
+				ctx, stop := setup(options)
+				defer stop()
+				if len(args) < 1 {
+					fmt.Fprintln(os.Stderr, "Usage: autogcm [flags] squash <base>..<head> [path...]")
+					os.Exit(exitError)
+				}
+				base, head, err := parseRange(args[0])
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(exitError)
+				}
+				options.Base, options.Head, options.Squash = base, head, true
+				options.Pathspecs = args[1:]
+				generate(ctx, *options)
+			},
+		},
+		&cobra.Command{
+			Use:       "completion bash|zsh|fish|powershell",
+			Short:     "Print the shell completion script",
+			Args:      cobra.ArbitraryArgs,
+			ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+			// The scripts do not depend on the configuration.
+			PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+			Run: func(cmd *cobra.Command, args []string) {
+				if err := runCompletion(root, args, os.Stdout); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+			},
+		},
+	)
+	return root
+}
+
+// subcommand returns a command that runs run once the configuration is
+// loaded, exiting with the status its error calls for.
+func subcommand(options *Options, use, short string, run func(ctx context.Context, args []string) error) *cobra.Command {
+	return &cobra.Command{
+		Use:               use,
+		Short:             short,
+		Args:              cobra.ArbitraryArgs,
+		ValidArgsFunction: cobra.NoFileCompletions,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, stop := setup(options)
+			defer stop()
+			if err := run(ctx, args); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitCode(err))
+			}
+		},
+	}
+}
+
+// longFlags rewrites flags written with a single dash, as in -model or -n
+// 3, to the double dash cobra expects, so that the spelling documented
+// since autogcm used the standard flag package keeps working. Values and
+// everything after "--" are left alone.
+func longFlags(root *cobra.Command, args []string) []string {
+	root.InitDefaultHelpFlag()
+	lookup := func(name string) *flag.Flag {
+		if f := root.PersistentFlags().Lookup(name); f != nil {
+			return f
+		}
+		return root.Flags().Lookup(name)
+	}
+
+	out := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return append(out, args[i:]...)
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			out = append(out, arg)
+			continue
+		}
+		name, _, hasValue := strings.Cut(strings.TrimPrefix(arg[1:], "-"), "=")
+		f := lookup(name)
+		switch {
+		case f == nil && arg[1] != '-' && len(name) > 1:
+			// Let cobra report -bogus as an unknown flag rather than
+			// as the shorthand -b.
+			out = append(out, "-"+arg)
+			continue
+		case f == nil:
+			out = append(out, arg)
+			continue
+		case arg[1] == '-':
+			out = append(out, arg)
+		default:
+			out = append(out, "-"+arg)
+		}
+		if !hasValue && f.NoOptDefVal == "" && i+1 < len(args) {
+			// The next argument is this flag's value.
+			i++
+			out = append(out, args[i])
+		}
+	}
+	return out
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// clipboardCommands returns the commands that can put text on the system
+// clipboard here, best first.
+func clipboardCommands() [][]string {
+	switch runtime.GOOS {
+	case "darwin":
+		return [][]string{{"pbcopy"}}
+	case "windows":
+		return [][]string{{"clip"}}
+	}
+	var commands [][]string
+	if isWSL() {
+		commands = append(commands, []string{"clip.exe"})
+	}
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		commands = append(commands, []string{"wl-copy"})
+	}
+	return append(commands,
+		[]string{"xclip", "-selection", "clipboard"},
+		[]string{"xsel", "--clipboard", "--input"},
+	)
+}
+
+// isWSL reports whether this is Linux running under the Windows Subsystem
+// for Linux, where the Windows clipboard is reached through clip.exe.
+func isWSL() bool {
+	if os.Getenv("WSL_DISTRO_NAME") != "" {
+		return true
+	}
+	version, err := os.ReadFile("/proc/version")
+	return err == nil && strings.Contains(strings.ToLower(string(version)), "microsoft")
+}
+
+// copyToClipboard puts text on the system clipboard with the first
+// clipboard command that is installed.
+func copyToClipboard(text string) error {
+	for _, command := range clipboardCommands() {
+		path, err := exec.LookPath(command[0])
+		if err != nil {
+			continue
+		}
+		cmd := exec.Command(path, command[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%s: %w: %s", command[0], err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+	return fmt.Errorf("no clipboard command found (install wl-clipboard, xclip or xsel)")
+}
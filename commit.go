@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// commit records message by running `git commit --file=-`, so hooks,
+// commit.gpgSign and the rest of the user's git configuration apply as
+// they would by hand. git's own output goes to stderr.
+func (g *CommitMessageGenerator) commit(message string) error {
+	if g.worktree == nil {
+		return fmt.Errorf("-commit needs a worktree")
+	}
+
+	args := []string{"-C", g.worktree.Filesystem.Root(), "commit", "--file=-"}
+	if g.options.All {
+		args = append(args, "--all")
+	}
+	if g.options.Amend {
+		args = append(args, "--amend")
+	}
+	if g.options.Quiet {
+		args = append(args, "--quiet")
+	}
+	// -signoff has already added the Signed-off-by trailer to message.
+
+	cmd := exec.Command("git", args...)
+	cmd.Stdin = strings.NewReader(message + "\n")
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running git commit: %w", err)
+	}
+	return nil
+}
+
+// push pushes the current branch to its upstream. A branch without one is
+// pushed with --set-upstream to remote.pushDefault, origin or the only
+// remote, in that order.
+func (g *CommitMessageGenerator) push() error {
+	root := g.worktree.Filesystem.Root()
+	args := []string{"-C", root, "push"}
+	if g.options.Quiet {
+		args = append(args, "--quiet")
+	}
+
+	upstream := exec.Command("git", "-C", root, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{upstream}")
+	if err := upstream.Run(); err != nil {
+		branch, err := g.currentBranch()
+		if err != nil {
+			return err
+		}
+		if branch == "" {
+			return fmt.Errorf("-push: HEAD is not on a branch")
+		}
+		remote, err := g.pushRemote()
+		if err != nil {
+			return err
+		}
+		args = append(args, "--set-upstream", remote, branch)
+	}
+
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running git push: %w", err)
+	}
+	return nil
+}
+
+// pushRemote picks the remote a new branch is pushed to.
+func (g *CommitMessageGenerator) pushRemote() (string, error) {
+	cfg, err := g.repo.Config()
+	if err != nil {
+		return "", fmt.Errorf("reading git config: %w", err)
+	}
+	if remote := cfg.Raw.Section("remote").Option("pushDefault"); remote != "" {
+		return remote, nil
+	}
+	if _, ok := cfg.Remotes["origin"]; ok {
+		return "origin", nil
+	}
+	if len(cfg.Remotes) == 1 {
+		for name := range cfg.Remotes {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("-push: the branch has no upstream and there is no single remote to push it to")
+}
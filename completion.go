@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+)
+
+// completionValues returns the values offered after a flag, or nil when
+// any value goes.
+func completionValues(name string) []string {
+	switch name {
+	case "backend":
+		return []string{backendGoGit, backendExec}
+	case "ticket":
+		return []string{ticketContext, ticketSubject, ticketFooter, ticketOff}
+	case "scope-from":
+		return []string{scopeFromDir, scopeFromPackage}
+	case "format":
+		return []string{formatText, formatJSON}
+	case "style-filter":
+		return []string{styleMine, styleNoMerges, styleNoBots}
+	case "style":
+		return sortedKeys(builtinStyles)
+	case "lang", "proofread-lang":
+		return sortedKeys(languageNames)
+	case "providers":
+		return providerNames
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// registerCompletions tells cobra what to offer after the flags of root:
+// the fixed values of completionValues, directories and files, and for
+// -model the model each provider would use with the configuration of the
+// repository being completed in.
+func registerCompletions(root *cobra.Command, options *Options) {
+	root.PersistentFlags().VisitAll(func(f *flag.Flag) {
+		if values := completionValues(f.Name); values != nil {
+			root.RegisterFlagCompletionFunc(f.Name, cobra.FixedCompletions(values, cobra.ShellCompDirectiveNoFileComp))
+		}
+	})
+	root.MarkPersistentFlagDirname("C")
+	for _, name := range []string{"system-prompt", "ca-cert", "audit-log"} {
+		root.MarkPersistentFlagFilename(name)
+	}
+
+	root.RegisterFlagCompletionFunc("model", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		// The flags typed so far, such as -C, are already parsed; warnings
+		// about the configuration would garble the completion.
+		notices = io.Discard
+		if err := loadConfig(flag.CommandLine, options.Dir); err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		// cobra parses the flags twice while completing, so a repeatable
+		// -providers lists each provider twice.
+		var models []string
+		for _, p := range newRegistry(*options).providers {
+			if model := p.Name() + "=" + p.Model(); p.Model() != "" && !slices.Contains(models, model) {
+				models = append(models, model)
+			}
+		}
+		return models, cobra.ShellCompDirectiveNoFileComp
+	})
+}
+
+// runCompletion implements `autogcm completion bash|zsh|fish|powershell`,
+// writing cobra's script for root. The script asks autogcm itself for
+// the candidates, so they follow the flags, subcommands and configuration.
+func runCompletion(root *cobra.Command, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: autogcm completion bash|zsh|fish|powershell")
+	}
+	switch args[0] {
+	case "bash":
+		return root.GenBashCompletionV2(out, true)
+	case "zsh":
+		return root.GenZshCompletion(out)
+	case "fish":
+		return root.GenFishCompletion(out, true)
+	case "powershell":
+		return root.GenPowerShellCompletionWithDesc(out)
+	}
+	return fmt.Errorf("unknown shell %q (want bash, zsh, fish or powershell)", args[0])
+}
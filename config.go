@@ -0,0 +1,257 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/config"
+	gitconfig "github.com/go-git/go-git/v5/plumbing/format/config"
+	flag "github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+const repoConfigFile = ".autogcm.yaml" // At the root of the worktree
+
+// flagEnv names the environment variable that sets a flag's default;
+// like a flag, it takes precedence over the configuration files.
+var flagEnv = map[string]string{
+	"backend":        "AUTOGCM_BACKEND",
+	"ticket":         "AUTOGCM_TICKET",
+	"ticket-pattern": "AUTOGCM_TICKET_PATTERN",
+	"lang":           "AUTOGCM_LANG",
+	"style":          "AUTOGCM_STYLE",
+	"system-prompt":  systemPromptFileEnv,
+}
+
+// unconfigurable flags only make sense on the command line.
+var unconfigurable = map[string]bool{"C": true}
+
+// repoConfigurable are the settings a repository may make in its
+// checked-in .autogcm.yaml. That file comes with a clone, so they are
+// limited to how the message is written; providers, the network, local
+// files, redaction and committing stay in the user's hands. The
+// repository's git config is the user's own and may set anything.
+var repoConfigurable = map[string]bool{
+	"ascii":             true,
+	"conventional":      true,
+	"detailed":          true,
+	"gitmoji":           true,
+	"gitmoji-map":       true,
+	"gitmoji-shortcode": true,
+	"lang":              true,
+	"oneline":           true,
+	"project":           true,
+	"proofread-lang":    true,
+	"scope-from":        true,
+	"scope-map":         true,
+	"structured":        true,
+	"style":             true,
+	"style-examples":    true,
+	"style-filter":      true,
+	"style-history":     true,
+	"subject-limit":     true,
+	"submodule-log":     true,
+	"template":          true,
+	"ticket-pattern":    true,
+	"wrap":              true,
+
+	// Only ever withhold more, so they add to the user's lists
+	"exclude":        true,
+	"exclude-ext":    true,
+	"exclude-larger": true,
+	"never-send":     true,
+}
+
+// repoAdditive are .autogcm.yaml settings added to the user's rather than
+// replacing them, so a repository cannot clear the user's exclusions.
+var repoAdditive = map[string]bool{
+	"exclude":        true,
+	"exclude-ext":    true,
+	"exclude-larger": true,
+	"never-send":     true,
+}
+
+// userConfigFile returns the path of the user's configuration file,
+// $XDG_CONFIG_HOME/autogcm/config.yaml or ~/.config/autogcm/config.yaml.
+func userConfigFile() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "autogcm", "config.yaml")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "autogcm", "config.yaml")
+}
+
+// gitConfigOnly are autogcm.* git config keys that are not flags.
+var gitConfigOnly = map[string]bool{"prompt": true} // See repoPromptContext
+
+// gitConfigAliases are git config keys that read more naturally than the
+// flag they set, as in `git config autogcm.provider openai`.
+var gitConfigAliases = map[string]string{"provider": "providers"}
+
+// loadConfig sets the flags not given on the command line or through their
+// environment variable from, in increasing precedence, the user's
+// configuration file, the repository's .autogcm.yaml and the autogcm
+// section of the global and then the repository's git config. Keys are
+// flag names; lists and maps set repeatable flags once per item. The
+// .autogcm.yaml may only make repoConfigurable settings.
+func loadConfig(fs *flag.FlagSet, dir string) error {
+	settings := map[string]any{}
+	additions := map[string][]any{}
+	set := func(source string, key string, value any, inRepo bool) error {
+		name := strings.TrimPrefix(key, "autogcm.")
+		if fs.Lookup(name) == nil || unconfigurable[name] {
+			return fmt.Errorf("%s: unknown setting %q", source, key)
+		}
+		switch {
+		case inRepo && !repoConfigurable[name]:
+			fmt.Fprintf(notices, "Warning: %s: ignoring %q, which only your own configuration can set\n", source, key)
+		case inRepo && repoAdditive[name]:
+			additions[name] = append(additions[name], configItems(value)...)
+		default:
+			settings[name] = value
+		}
+		return nil
+	}
+
+	repo, err := openRepository(dir)
+	if err != nil {
+		repo = nil
+	}
+
+	files := []string{userConfigFile()}
+	repoFile := ""
+	if repo != nil {
+		if worktree, err := repo.Worktree(); err == nil {
+			repoFile = filepath.Join(worktree.Filesystem.Root(), repoConfigFile)
+			files = append(files, repoFile)
+		}
+	}
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("reading config: %w", err)
+		}
+		var values map[string]any
+		if err := yaml.Unmarshal(data, &values); err != nil {
+			return fmt.Errorf("parsing %s: %w", file, err)
+		}
+		for name, value := range values {
+			if err := set(file, name, value, file == repoFile); err != nil {
+				return err
+			}
+		}
+	}
+
+	var sections []*gitconfig.Section
+	if global, err := config.LoadConfig(config.GlobalScope); err == nil {
+		sections = append(sections, global.Raw.Section("autogcm"))
+	}
+	if repo != nil {
+		if local, err := repo.Config(); err == nil {
+			sections = append(sections, local.Raw.Section("autogcm"))
+		}
+	}
+	for _, section := range sections {
+		values := map[string][]any{}
+		for _, option := range section.Options {
+			name := strings.ToLower(option.Key)
+			if alias, ok := gitConfigAliases[name]; ok {
+				name = alias
+			}
+			if !gitConfigOnly[name] {
+				values[name] = append(values[name], option.Value)
+			}
+		}
+		for name, list := range values {
+			var value any = list
+			if len(list) == 1 {
+				value = list[0]
+			}
+			if err := set("git config", "autogcm."+name, value, false); err != nil {
+				return err
+			}
+		}
+	}
+
+	explicit := map[string]bool{}
+	fs.VisitAll(func(f *flag.Flag) { explicit[f.Name] = f.Changed })
+
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if explicit[name] || flagEnv[name] != "" && os.Getenv(flagEnv[name]) != "" {
+			continue
+		}
+		if err := setConfigValue(fs, name, settings[name]); err != nil {
+			return fmt.Errorf("config setting %s: %w", name, err)
+		}
+	}
+	for _, name := range sortedKeys(additions) {
+		if err := setConfigValue(fs, name, additions[name]); err != nil {
+			return fmt.Errorf("config setting %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// configItems returns a setting's value as the items setConfigValue
+// would set one by one.
+func configItems(value any) []any {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []any:
+		return v
+	case map[string]any:
+		var items []any
+		for _, k := range sortedKeys(v) {
+			items = append(items, fmt.Sprintf("%s=%v", k, v[k]))
+		}
+		return items
+	}
+	return []any{value}
+}
+
+// setConfigValue sets the flag called name from a YAML value.
+func setConfigValue(fs *flag.FlagSet, name string, value any) error {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []any:
+		for _, item := range v {
+			if err := fs.Set(name, fmt.Sprint(item)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := fs.Set(name, fmt.Sprintf("%s=%v", k, v[k])); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fs.Set(name, fmt.Sprint(value))
+}
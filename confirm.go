@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// confirmSend shows which files and how many bytes are about to be sent
+// to p and asks before sending them, once per provider, when -confirm is
+// given without -yes.
+func (g *CommitMessageGenerator) confirmSend(p Provider, patches []FilePatch, prompt Prompt) error {
+	return g.confirm(p, func(w io.Writer) { printSendSummary(w, p, patches, prompt) })
+}
+
+// confirmFollowUp asks like confirmSend before a request about the message
+// rather than the diff, such as -explain and -proofread make. It only asks
+// when nothing was confirmed for p yet, e.g. after a cached answer.
+func (g *CommitMessageGenerator) confirmFollowUp(p Provider, req GenerateRequest, what string) error {
+	return g.confirm(p, func(w io.Writer) {
+		fmt.Fprintf(w, "About to send %d bytes to %s (%s): %s\n", len(req.System)+len(req.User), p.Name(), p.Model(), what)
+	})
+}
+
+func (g *CommitMessageGenerator) confirm(p Provider, summary func(w io.Writer)) error {
+	if !g.options.Confirm || g.options.Yes || g.confirmed[p.Name()] {
+		return nil
+	}
+	spin.Clear()
+	summary(os.Stderr)
+	fmt.Fprint(os.Stderr, "Send? [y/N] ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return errAborted
+	}
+	if answer := strings.ToLower(strings.TrimSpace(line)); answer != "y" && answer != "yes" {
+		return errAborted
+	}
+
+	if g.confirmed == nil {
+		g.confirmed = map[string]bool{}
+	}
+	g.confirmed[p.Name()] = true
+	return nil
+}
+
+// printSendSummary lists what a request to p carries.
+func printSendSummary(w io.Writer, p Provider, patches []FilePatch, prompt Prompt) {
+	fmt.Fprintf(w, "About to send %d bytes to %s (%s):\n", len(prompt.System)+len(prompt.User), p.Name(), p.Model())
+	for _, patch := range patches {
+		fmt.Fprintf(w, "  %s (%s)\n", patch.Path, sendStatus(prompt.Report, patch.Path))
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const maxConventionalRetries = 2 // Corrective requests after a malformed message
+
+// conventionalTypes are the types accepted in -conventional mode, from the
+// Angular convention most Conventional Commits tooling uses.
+var conventionalTypes = []string{"feat", "fix", "docs", "style", "refactor", "perf", "test", "build", "ci", "chore", "revert"}
+
+const conventionalPrompt = `
+
+# Conventional Commits
+
+メッセージは Conventional Commits 1.0.0 に従うこと。この形式はこれまでの条件より優先する。
+
+- 1行目は ` + "`type(scope): subject`" + ` の形式にする。scope は省略してよい（` + "`type: subject`" + `）
+- type は %s のいずれか
+- 後方互換性のない変更は type(scope) の直後に ! を付ける
+- 本文を書く場合は1行目の後に空行を入れる
+`
+
+const conventionalRetryPrompt = `
+
+# 修正依頼
+
+前回の出力は Conventional Commits の形式になっていなかった。
+
+前回の出力:
+` + "```" + `
+%s
+` + "```" + `
+
+問題点:
+%s
+問題点を直したメッセージのみを出力すること。
+`
+
+// conventionalHeader matches "type(scope)!: description".
+var conventionalHeader = regexp.MustCompile(`^([a-z]+)(\(([^()\s]+)\))?(!)?: (.*)$`)
+
+// validateConventional returns what keeps message from being a valid
+// Conventional Commit; nil when it is one.
+func validateConventional(message string) []string {
+	lines := strings.Split(message, "\n")
+	m := conventionalHeader.FindStringSubmatch(lines[0])
+	if m == nil {
+		return []string{fmt.Sprintf("the first line %q is not \"type(scope): subject\"", lines[0])}
+	}
+
+	var problems []string
+	if !isConventionalType(m[1]) {
+		problems = append(problems, fmt.Sprintf("unknown type %q (want one of %s)", m[1], strings.Join(conventionalTypes, ", ")))
+	}
+	if strings.TrimSpace(m[5]) == "" {
+		problems = append(problems, "the subject after the colon is empty")
+	}
+	if len(lines) > 1 && strings.TrimSpace(lines[1]) != "" {
+		problems = append(problems, "the body is not separated from the first line by a blank line")
+	}
+	return problems
+}
+
+// conventionalScope returns the scope of a Conventional Commits header.
+func conventionalScope(message string) string {
+	if m := conventionalHeader.FindStringSubmatch(strings.SplitN(message, "\n", 2)[0]); m != nil {
+		return m[3]
+	}
+	return ""
+}
+
+// checkBreaking reports a message that does not mark the breaking changes
+// found in the diff.
+func checkBreaking(message string) []string {
+	var problems []string
+	if m := conventionalHeader.FindStringSubmatch(strings.SplitN(message, "\n", 2)[0]); m != nil && m[4] == "" {
+		problems = append(problems, "the change is breaking but the type has no !")
+	}
+	if !strings.Contains(message, "BREAKING CHANGE: ") {
+		problems = append(problems, "the BREAKING CHANGE: footer is missing")
+	}
+	return problems
+}
+
+func isConventionalType(t string) bool {
+	for _, known := range conventionalTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// conventionalProblems lists everything wrong with message as a
+// Conventional Commit restricted to scopes.
+func conventionalProblems(message string, scopes []string, breaking bool) []string {
+	problems := validateConventional(message)
+	if problem := checkScope(conventionalScope(message), scopes); problem != "" {
+		problems = append(problems, problem)
+	}
+	if breaking {
+		problems = append(problems, checkBreaking(message)...)
+	}
+	return problems
+}
+
+// conventionalCandidates keeps the alternative candidates that are valid
+// Conventional Commits; only the first answer is worth a retry.
+func conventionalCandidates(candidates []Candidate, scopes []string, breaking bool) []Candidate {
+	var valid []Candidate
+	for _, c := range candidates {
+		if len(conventionalProblems(c.Message, scopes, breaking)) == 0 {
+			valid = append(valid, c)
+		}
+	}
+	return valid
+}
+
+// conventionalRetry asks the model to fix the problems of its last answer.
+func conventionalRetry(message string, problems []string) string {
+	var list strings.Builder
+	for _, problem := range problems {
+		fmt.Fprintf(&list, "- %s\n", problem)
+	}
+	return fmt.Sprintf(conventionalRetryPrompt, message, list.String())
+}
+
+// ConventionalText renders a structured message as a Conventional Commit.
+func (m *StructuredMessage) ConventionalText() string {
+	header := strings.TrimSpace(m.Type)
+	if scope := strings.TrimSpace(m.Scope); scope != "" {
+		header += "(" + scope + ")"
+	}
+	header += ": " + strings.TrimSpace(m.Subject)
+	if body := strings.TrimSpace(m.Body); body != "" {
+		return header + "\n\n" + body
+	}
+	return header
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestValidateConventional(t *testing.T) {
+	tests := []struct {
+		message string
+		want    []string
+	}{
+		{"feat(api): add pagination", nil},
+		{"fix!: drop the v1 endpoint\n\nBREAKING CHANGE: v1 is gone", nil},
+		{"docs: fix a typo", nil},
+		{"Add pagination", []string{`the first line "Add pagination" is not "type(scope): subject"`}},
+		{"feat(api):add pagination", []string{`the first line "feat(api):add pagination" is not "type(scope): subject"`}},
+		{"feature: add pagination", []string{"unknown type \"feature\" (want one of feat, fix, docs, style, refactor, perf, test, build, ci, chore, revert)"}},
+		{"fix:  ", []string{"the subject after the colon is empty"}},
+		{"fix: handle nil\nThe body follows at once.", []string{"the body is not separated from the first line by a blank line"}},
+	}
+	for _, tt := range tests {
+		if got := validateConventional(tt.message); !slices.Equal(got, tt.want) {
+			t.Errorf("validateConventional(%q) = %q, want %q", tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestConventionalProblems(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  string
+		scopes   []string
+		breaking bool
+		want     []string
+	}{
+		{"allowed scope", "feat(api): add pagination", []string{"api", "cli"}, false, nil},
+		{"no scope", "feat: add pagination", []string{"api"}, false, nil},
+		{"other scope", "feat(web): add pagination", []string{"api", "cli"}, false, []string{`scope "web" is not one of api, cli`}},
+		{"scope not wanted", "feat(web): add pagination", nil, false, []string{`scope "web" should be omitted`}},
+		{"breaking, marked", "feat(api)!: drop v1\n\nBREAKING CHANGE: v1 is gone", []string{"api"}, true, nil},
+		{
+			name:     "breaking, unmarked",
+			message:  "feat(api): drop v1",
+			scopes:   []string{"api"},
+			breaking: true,
+			want:     []string{"the change is breaking but the type has no !", "the BREAKING CHANGE: footer is missing"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := conventionalProblems(tt.message, tt.scopes, tt.breaking); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConventionalText(t *testing.T) {
+	tests := []struct {
+		message StructuredMessage
+		want    string
+	}{
+		{StructuredMessage{Type: "feat", Scope: "api", Subject: "add pagination"}, "feat(api): add pagination"},
+		{StructuredMessage{Type: "fix", Subject: " handle nil ", Body: "\nThe cache may be empty.\n"}, "fix: handle nil\n\nThe cache may be empty."},
+	}
+	for _, tt := range tests {
+		if got := tt.message.ConventionalText(); got != tt.want {
+			t.Errorf("ConventionalText() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// Usage is the token accounting for a single generation.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// modelPrice is the list price of a model in USD per million tokens.
+type modelPrice struct {
+	Input  float64
+	Output float64
+}
+
+var modelPrices = map[string]modelPrice{
+	"llama3-70b-8192":        {Input: 0.59, Output: 0.79},
+	"gpt-4o-mini-2024-07-18": {Input: 0.15, Output: 0.60},
+}
+
+// estimateCost returns the estimated cost in USD of usage on model, and
+// whether the model is in the price table.
+func estimateCost(model string, usage Usage) (float64, bool) {
+	price, ok := modelPrices[model]
+	if !ok {
+		return 0, false
+	}
+	return (float64(usage.PromptTokens)*price.Input + float64(usage.CompletionTokens)*price.Output) / 1e6, true
+}
+
+func printCost(w io.Writer, result Result) {
+	if result.Cached {
+		fmt.Fprintf(w, "%s %s: cached, no tokens used\n", result.Provider, result.Model)
+		return
+	}
+	fmt.Fprintf(w, "%s %s: %d prompt + %d completion tokens", result.Provider, result.Model,
+		result.Usage.PromptTokens, result.Usage.CompletionTokens)
+	if cost, ok := estimateCost(result.Model, result.Usage); ok {
+		fmt.Fprintf(w, ", estimated cost $%.6f", cost)
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// credential is an API key read from an environment variable or, when the
+// variable is unset, from the output of the command in AUTOGCM_<NAME>_CMD
+// (e.g. AUTOGCM_OPENAI_API_KEY_CMD="op read op://dev/openai/key"), and
+// finally from the OS keychain entry written by `autogcm auth set`. The
+// command runs at most once, and only when the key is actually needed.
+type credential struct {
+	env      string
+	provider string // Keychain account name
+
+	keyringOnce  sync.Once
+	keyringValue string
+
+	once  sync.Once
+	value string
+	err   error
+}
+
+func newCredential(env string, provider string) *credential {
+	return &credential{env: env, provider: provider}
+}
+
+func (c *credential) commandEnv() string {
+	return "AUTOGCM_" + c.env + "_CMD"
+}
+
+// Configured reports whether a key, a key command or a keychain entry is
+// set, without running the command.
+func (c *credential) Configured() bool {
+	return os.Getenv(c.env) != "" || os.Getenv(c.commandEnv()) != "" || c.keyring() != ""
+}
+
+func (c *credential) keyring() string {
+	c.keyringOnce.Do(func() {
+		c.keyringValue = keyringGet(c.provider)
+	})
+	return c.keyringValue
+}
+
+// Hint tells the user how the credential can be provided.
+func (c *credential) Hint() string {
+	return fmt.Sprintf("set %s or %s, or run `autogcm auth set %s`", c.env, c.commandEnv(), c.provider)
+}
+
+func (c *credential) Get() (string, error) {
+	c.once.Do(func() {
+		if v := os.Getenv(c.env); v != "" {
+			c.value = v
+			return
+		}
+		command := os.Getenv(c.commandEnv())
+		if command == "" {
+			if c.value = c.keyring(); c.value == "" {
+				c.err = fmt.Errorf("%s is not set", c.env)
+			}
+			return
+		}
+		c.value, c.err = runKeyCommand(command)
+		if c.err != nil {
+			c.err = fmt.Errorf("running %s: %w", c.commandEnv(), c.err)
+		}
+	})
+	return c.value, c.err
+}
+
+func runKeyCommand(command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	key := strings.TrimSpace(string(out))
+	if key == "" {
+		return "", fmt.Errorf("command printed no key")
+	}
+	return key, nil
+}
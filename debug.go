@@ -0,0 +1,15 @@
+package main
+
+import (
+	"io"
+	"log"
+)
+
+// debugLog receives the -v diagnostics: provider selection, diff
+// statistics, token estimates, HTTP statuses and retries. It discards
+// everything unless -v is given.
+var debugLog = log.New(io.Discard, "autogcm: ", log.Ltime|log.Lmicroseconds)
+
+func debugf(format string, args ...any) {
+	debugLog.Printf(format, args...)
+}
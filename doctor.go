@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// healthChecker is implemented by providers that can verify their endpoint
+// and credentials without generating anything.
+type healthChecker interface {
+	Ping(ctx context.Context) error
+	// ConfigHint tells the user how to configure the provider.
+	ConfigHint() string
+}
+
+var errDoctorFailed = errors.New("some checks failed")
+
+// runDoctor checks the environment autogcm needs and prints what to fix.
+func runDoctor(ctx context.Context, options Options, out io.Writer) error {
+	failed := false
+	report := func(ok bool, format string, args ...any) {
+		mark := "✓"
+		if !ok {
+			mark = "✗"
+			failed = true
+		}
+		fmt.Fprintf(out, "%s %s\n", mark, fmt.Sprintf(format, args...))
+	}
+
+	repo, err := openRepository(options.Dir)
+	if err != nil {
+		report(false, "git repository: %v (run autogcm inside a repository or pass -C <path>)", err)
+	} else {
+		report(true, "git repository found")
+
+		generator := &CommitMessageGenerator{repo: repo, options: options}
+		generator.worktree, err = repo.Worktree()
+		if err != nil {
+			report(false, "worktree: %v", err)
+		} else if patches, err := generator.getStagedDiff(); err != nil {
+			report(false, "reading staged changes: %v", err)
+		} else if len(patches) == 0 {
+			report(false, "no staged changes (stage files with `git add` first)")
+		} else {
+			report(true, "%d staged file(s)", len(patches))
+		}
+	}
+
+	registry := newRegistry(options)
+	available := 0
+	for _, p := range registry.providers {
+		checker, _ := p.(healthChecker)
+		if !p.Available() {
+			hint := ""
+			if checker != nil {
+				hint = " (" + checker.ConfigHint() + ")"
+			}
+			fmt.Fprintf(out, "- %s: not configured%s\n", p.Name(), hint)
+			continue
+		}
+		available++
+
+		if checker == nil {
+			report(true, "%s: configured", p.Name())
+			continue
+		}
+		if err := checker.Ping(ctx); err != nil {
+			report(false, "%s: %v", p.Name(), err)
+			continue
+		}
+		report(true, "%s: reachable, API key accepted (model %s)", p.Name(), p.Model())
+	}
+	if available == 0 {
+		report(false, "no provider configured (set GROQ_API_KEY or OPENAI_API_KEY, or run `autogcm init`)")
+	}
+
+	if _, version, err := loadSystemPrompt(options.SystemPrompt); err != nil {
+		report(false, "system prompt: %v", err)
+	} else {
+		report(true, "system prompt: %s", version)
+	}
+
+	if failed {
+		return errDoctorFailed
+	}
+	return nil
+}
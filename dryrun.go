@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// printDryRun writes the system prompt and diff that would be sent to the
+// first provider, with their token counts and what was left out, without
+// calling it.
+func (g *CommitMessageGenerator) printDryRun(w io.Writer, patches []FilePatch) error {
+	p := g.registry.First()
+	counter, err := newTokenCounter(p.Model())
+	if err != nil {
+		return err
+	}
+	prompt := g.promptFor(p, patches, counter)
+
+	fmt.Fprintf(w, "=== system (%s %s, %d tokens) ===\n%s\n", p.Name(), p.Model(), counter.Count(prompt.System), prompt.System)
+	fmt.Fprintf(w, "=== user (%d tokens) ===\n%s\n", counter.Count(prompt.User), prompt.User)
+	if prompt.Report.Degraded() {
+		fmt.Fprintf(w, "=== left out ===\n%s\n", prompt.Report)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const editHelp = `
+# Edit the commit message autogcm generated. Lines starting with '#' are
+# ignored, and an empty message aborts.
+`
+
+// editorCommand returns the editor git would use: GIT_EDITOR, core.editor,
+// VISUAL, EDITOR and then git's default, as resolved by `git var`.
+func (g *CommitMessageGenerator) editorCommand() (string, error) {
+	args := []string{"var", "GIT_EDITOR"}
+	if g.worktree != nil {
+		args = append([]string{"-C", g.worktree.Filesystem.Root()}, args...)
+	}
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("finding the editor: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// editMessage opens message in the user's editor and returns what was
+// saved, without comment lines. An emptied message is errAborted.
+func (g *CommitMessageGenerator) editMessage(message string) (string, error) {
+	editor, err := g.editorCommand()
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.CreateTemp("", "autogcm-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("creating message file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(message + "\n" + editHelp)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("writing message file: %w", err)
+	}
+
+	// Like git, let the shell parse the editor so it may carry arguments.
+	spin.Clear()
+	cmd := exec.Command("sh", "-c", editor+` "$@"`, editor, file.Name())
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("running editor %q: %w", editor, err)
+	}
+
+	edited, err := os.ReadFile(file.Name())
+	if err != nil {
+		return "", fmt.Errorf("reading message file: %w", err)
+	}
+	var lines []string
+	for _, line := range strings.Split(string(edited), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			lines = append(lines, strings.TrimRight(line, " \t\r"))
+		}
+	}
+	message = strings.TrimSpace(strings.Join(lines, "\n"))
+	if message == "" {
+		return "", errAborted
+	}
+	return message, nil
+}
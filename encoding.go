@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// legacyEncodings are tried, in order, for text that is not valid UTF-8.
+var legacyEncodings = []struct {
+	name     string
+	encoding encoding.Encoding
+}{
+	{"Shift_JIS", japanese.ShiftJIS},
+	{"EUC-JP", japanese.EUCJP},
+}
+
+// toUTF8 converts text in UTF-16 or a common legacy encoding to UTF-8 so
+// that it is not mistaken for binary data or sent as mojibake. It returns
+// the name of the detected encoding, or "" when content is already UTF-8
+// or could not be identified.
+func toUTF8(content string) (string, string) {
+	if content == "" || utf8.ValidString(content) && !looksLikeUTF16(content) {
+		return content, ""
+	}
+
+	if name, enc := utf16Encoding(content); enc != nil {
+		if decoded, err := enc.NewDecoder().String(content); err == nil {
+			return decoded, name
+		}
+	}
+
+	if strings.IndexByte(content, 0) != -1 {
+		return content, "" // Binary
+	}
+	for _, legacy := range legacyEncodings {
+		decoded, err := legacy.encoding.NewDecoder().String(content)
+		if err == nil && !strings.ContainsRune(decoded, utf8.RuneError) {
+			return decoded, legacy.name
+		}
+	}
+
+	return content, ""
+}
+
+// utf16Encoding identifies UTF-16 by its byte order mark, or by the NUL
+// high bytes of mostly ASCII text.
+func utf16Encoding(content string) (string, encoding.Encoding) {
+	switch {
+	case strings.HasPrefix(content, "\xff\xfe"):
+		return "UTF-16LE", unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)
+	case strings.HasPrefix(content, "\xfe\xff"):
+		return "UTF-16BE", unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)
+	}
+	if !looksLikeUTF16(content) {
+		return "", nil
+	}
+	if content[0] == 0 {
+		return "UTF-16BE", unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	}
+	return "UTF-16LE", unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+}
+
+// looksLikeUTF16 reports whether NUL bytes appear on only one of the even
+// or odd positions, as they do in UTF-16 encoded ASCII.
+func looksLikeUTF16(content string) bool {
+	sample := content
+	if len(sample) > 8000 {
+		sample = sample[:8000]
+	}
+	if len(sample) < 2 || len(sample)%2 != 0 {
+		return false
+	}
+
+	var even, odd int
+	for i := 0; i < len(sample); i++ {
+		if sample[i] == 0 {
+			if i%2 == 0 {
+				even++
+			} else {
+				odd++
+			}
+		}
+	}
+	half := len(sample) / 2
+	return (even > half*9/10 && odd == 0) || (odd > half*9/10 && even == 0)
+}
+
+// noteEncoding adds an extended header line after "diff --git" telling the
+// model that the file was converted for display.
+func noteEncoding(patch string, encodings ...string) string {
+	var names []string
+	for _, name := range encodings {
+		if name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return patch
+	}
+
+	header, rest, _ := strings.Cut(patch, "\n")
+	var b bytes.Buffer
+	b.WriteString(header + "\n")
+	fmt.Fprintf(&b, "encoding %s (converted to UTF-8)\n", strings.Join(names, ", "))
+	b.WriteString(rest)
+	return b.String()
+}
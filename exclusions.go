@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// ExclusionRules extend the built-in list of files whose content is not
+// sent to the model. Patterns use gitignore syntax.
+type ExclusionRules struct {
+	ExcludeExtensions []string    // Added to excludedExtensions, e.g. ".bin"
+	IncludeExtensions []string    // Removed from excludedExtensions, e.g. ".sum"
+	Patterns          []string    // Paths to exclude, e.g. "testdata/**"
+	SizeLimits        []SizeLimit // Exclude matching files above a size
+}
+
+// SizeLimit excludes files matching Pattern (all files when empty) whose
+// content is larger than MaxBytes.
+type SizeLimit struct {
+	Pattern  string
+	MaxBytes int64
+}
+
+// exclusions is the compiled form of ExclusionRules.
+type exclusions struct {
+	extensions map[string]bool
+	patterns   gitignore.Matcher
+	sizeLimits []compiledSizeLimit
+}
+
+type compiledSizeLimit struct {
+	pattern  gitignore.Pattern // nil matches every file
+	maxBytes int64
+}
+
+func newExclusions(rules ExclusionRules) exclusions {
+	e := exclusions{extensions: map[string]bool{}}
+	for ext, on := range excludedExtensions {
+		e.extensions[ext] = on
+	}
+	for _, ext := range rules.ExcludeExtensions {
+		e.extensions[normalizeExtension(ext)] = true
+	}
+	for _, ext := range rules.IncludeExtensions {
+		delete(e.extensions, normalizeExtension(ext))
+	}
+
+	if len(rules.Patterns) > 0 {
+		var patterns []gitignore.Pattern
+		for _, p := range rules.Patterns {
+			patterns = append(patterns, gitignore.ParsePattern(p, nil))
+		}
+		e.patterns = gitignore.NewMatcher(patterns)
+	}
+
+	for _, limit := range rules.SizeLimits {
+		compiled := compiledSizeLimit{maxBytes: limit.MaxBytes}
+		if limit.Pattern != "" {
+			compiled.pattern = gitignore.ParsePattern(limit.Pattern, nil)
+		}
+		e.sizeLimits = append(e.sizeLimits, compiled)
+	}
+
+	return e
+}
+
+func normalizeExtension(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// excludesPath reports whether the path alone excludes a file.
+func (e exclusions) excludesPath(filePath string) bool {
+	if e.extensions[strings.ToLower(filepath.Ext(filePath))] {
+		return true
+	}
+	return e.patterns != nil && e.patterns.Match(strings.Split(filePath, "/"), false)
+}
+
+// exceedsSizeLimit reports whether a file of the given size is over a
+// limit that applies to its path.
+func (e exclusions) exceedsSizeLimit(filePath string, size int) bool {
+	parts := strings.Split(filePath, "/")
+	for _, limit := range e.sizeLimits {
+		if limit.pattern != nil && limit.pattern.Match(parts, false) != gitignore.Exclude {
+			continue
+		}
+		if int64(size) > limit.maxBytes {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSizeLimit parses a -exclude-larger value: "SIZE" or "PATTERN=SIZE",
+// where SIZE is a byte count with an optional k, m or g suffix.
+func parseSizeLimit(value string) (SizeLimit, error) {
+	pattern, size := "", value
+	if i := strings.LastIndex(value, "="); i >= 0 {
+		pattern, size = value[:i], value[i+1:]
+	}
+	maxBytes, err := parseSize(size)
+	if err != nil {
+		return SizeLimit{}, fmt.Errorf("invalid size limit %q: %w", value, err)
+	}
+	return SizeLimit{Pattern: pattern, MaxBytes: maxBytes}, nil
+}
+
+func parseSize(s string) (int64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(s, "k"):
+		multiplier, s = 1024, strings.TrimSuffix(s, "k")
+	case strings.HasSuffix(s, "m"):
+		multiplier, s = 1024*1024, strings.TrimSuffix(s, "m")
+	case strings.HasSuffix(s, "g"):
+		multiplier, s = 1024*1024*1024, strings.TrimSuffix(s, "g")
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("not a size: %q", s)
+	}
+	return n * multiplier, nil
+}
+
+// listFlag is a flag that may be repeated; each value may also hold a
+// comma-separated list.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Type() string {
+	return "list"
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// sizeLimitFlag collects repeated -exclude-larger values.
+type sizeLimitFlag []SizeLimit
+
+func (f *sizeLimitFlag) String() string {
+	var parts []string
+	for _, limit := range *f {
+		parts = append(parts, fmt.Sprintf("%s=%d", limit.Pattern, limit.MaxBytes))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (f *sizeLimitFlag) Type() string {
+	return "[pattern=]size"
+}
+
+func (f *sizeLimitFlag) Set(value string) error {
+	limit, err := parseSizeLimit(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, limit)
+	return nil
+}
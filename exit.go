@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// Exit statuses, so that wrappers and hooks can tell why autogcm failed.
+const (
+	exitError           = 1 // Anything else, including invalid flags and aborting
+	exitNoChanges       = 2 // Nothing staged, or nothing left to describe
+	exitNoProvider      = 3
+	exitProvidersFailed = 4 // Every provider failed or none answered in time
+	exitGitError        = 5 // Opening the repository, reading the diff, committing or pushing
+)
+
+var errNoProvider = errors.New("no provider configured")
+
+// gitError marks a failure of git or the repository rather than of
+// autogcm or a provider.
+type gitError struct{ err error }
+
+func (e gitError) Error() string { return e.err.Error() }
+func (e gitError) Unwrap() error { return e.err }
+
+// exitCode returns the exit status for a failure to set up or to collect
+// the diff.
+func exitCode(err error) int {
+	var gitErr gitError
+	switch {
+	case errors.Is(err, errNoProvider):
+		return exitNoProvider
+	case errors.As(err, &gitErr):
+		return exitGitError
+	}
+	return exitError
+}
+
+// notices receives what autogcm reports on stderr besides errors: notes,
+// warnings, the answer as it streams in and retries. -quiet discards it.
+var notices io.Writer = os.Stderr
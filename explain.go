@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const explainPrompt = `You explain why a git commit message was written the way it was.
+You are given the commit message and the changed files with their line
+counts and whether their diff was sent in full, truncated, only listed or
+excluded. In at most six short bullet points, say which files drove the
+subject line, which changes the body covers, and which changes the
+message leaves out and why that is reasonable. Answer in the language of
+the commit message. Output only the bullet points.`
+
+// sendStatus says how the diff of path was sent: in full, truncated, only
+// listed or excluded.
+func sendStatus(report DiffReport, path string) string {
+	switch {
+	case slices.Contains(report.Excluded, path):
+		return "excluded"
+	case slices.Contains(report.Omitted, path):
+		return "only listed"
+	case slices.Contains(report.Truncated, path):
+		return "truncated"
+	}
+	return "sent in full"
+}
+
+// explanationInput lists what the model saw for each file, next to the
+// message it wrote.
+func explanationInput(message string, patches []FilePatch, report DiffReport) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Commit message:\n```\n%s\n```\n\nChanged files:\n", message)
+	for _, p := range patches {
+		added, removed := diffstat(p.Patch)
+		fmt.Fprintf(&b, "- %s (+%d -%d, %s)\n", p.Path, added, removed, sendStatus(report, p.Path))
+	}
+	return b.String()
+}
+
+// explain asks the provider that wrote message for its rationale, shown as
+// it arrives. It is best effort: a failure is reported and yields "".
+func (g *CommitMessageGenerator) explain(ctx context.Context, result Result, message string, patches []FilePatch) string {
+	p := g.registry.Lookup(result.Provider)
+	if p == nil {
+		return ""
+	}
+
+	req := GenerateRequest{
+		System:   explainPrompt,
+		User:     explanationInput(message, patches, result.Report),
+		Sampling: g.options.Sampling,
+	}
+	if err := g.confirmFollowUp(p, req, "the message and the names of the changed files, to explain it"); err != nil {
+		fmt.Fprintln(notices, "Not explaining the message.")
+		return ""
+	}
+	fmt.Fprintln(notices, "Rationale:")
+	resp, err := p.Generate(ctx, req)
+	if err != nil {
+		fmt.Fprintf(notices, "explaining failed: %v\n", err)
+		return ""
+	}
+	return cleanMessage(resp.Content)
+}
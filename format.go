@@ -0,0 +1,154 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/width"
+)
+
+const defaultWrapColumn = 72 // Body width git tooling and most style guides expect
+
+var (
+	// unwrappable matches body lines that must be kept as they are:
+	// indented code, trailers such as "Refs: #1" and bare URLs.
+	unwrappable = regexp.MustCompile(`^(\s{4}|\t|[A-Za-z][\w-]*: \S|BREAKING CHANGE: |https?://\S+$)`)
+	// listItem matches the marker of a bulleted or numbered list item.
+	listItem = regexp.MustCompile(`^(\s*(?:[-*+]|\d+[.)])\s+)`)
+)
+
+// displayWidth counts the columns text takes in a terminal, where East
+// Asian wide characters take two.
+func displayWidth(text string) int {
+	n := 0
+	for _, r := range text {
+		n += runeWidth(r)
+	}
+	return n
+}
+
+func runeWidth(r rune) int {
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+// formatMessage enforces the layout of a commit message locally: a subject
+// of at most subjectLimit columns, a blank line before the body, and body
+// paragraphs wrapped at wrapColumn. A limit of 0 disables that rule.
+func formatMessage(message string, subjectLimit int, wrapColumn int) string {
+	subject, body, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	subject = strings.TrimSpace(subject)
+	body = strings.Trim(body, "\n")
+
+	if subjectLimit > 0 && displayWidth(subject) > subjectLimit {
+		// Keep the full subject as the first paragraph of the body.
+		full := subject
+		subject = truncateSubject(subject, subjectLimit)
+		if body == "" {
+			body = full
+		} else {
+			body = full + "\n\n" + body
+		}
+	}
+
+	if body == "" {
+		return subject
+	}
+	if wrapColumn > 0 {
+		body = wrapBody(body, wrapColumn)
+	}
+	return subject + "\n\n" + body
+}
+
+// truncateSubject cuts a subject to limit columns including a trailing
+// ellipsis, at a word boundary when there is one in the second half.
+func truncateSubject(subject string, limit int) string {
+	var b strings.Builder
+	used, lastSpace := 0, -1
+	for _, r := range subject {
+		w := runeWidth(r)
+		if used+w > limit-1 {
+			break
+		}
+		if r == ' ' {
+			lastSpace = b.Len()
+		}
+		b.WriteRune(r)
+		used += w
+	}
+	cut := b.String()
+	if lastSpace > len(cut)/2 {
+		cut = cut[:lastSpace]
+	}
+	return strings.TrimRight(cut, " ,.:;、。") + "…"
+}
+
+// wrapBody hard-wraps the paragraphs and list items of a body. Code
+// blocks, trailers and URLs are left untouched.
+func wrapBody(body string, column int) string {
+	var out []string
+	inFence := false
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+			out = append(out, line)
+			continue
+		}
+		if inFence || unwrappable.MatchString(line) || displayWidth(line) <= column {
+			out = append(out, line)
+			continue
+		}
+
+		indent := ""
+		if m := listItem.FindString(line); m != "" {
+			indent = strings.Repeat(" ", displayWidth(m))
+		}
+		out = append(out, wrapLine(line, column, indent)...)
+	}
+	return strings.Join(out, "\n")
+}
+
+// wrapLine breaks a line at spaces, or between wide characters for text
+// without spaces such as Japanese, continuing with indent.
+func wrapLine(line string, column int, indent string) []string {
+	var lines []string
+	var current strings.Builder
+	used := 0
+	breakAt := -1 // Byte offset in current of the last break opportunity
+
+	flush := func(upTo int) {
+		text := current.String()
+		lines = append(lines, strings.TrimRight(text[:upTo], " "))
+		rest := strings.TrimLeft(text[upTo:], " ")
+		current.Reset()
+		current.WriteString(indent + rest)
+		used = displayWidth(indent + rest)
+		breakAt = -1
+	}
+
+	for _, r := range line {
+		w := runeWidth(r)
+		if used+w > column && current.Len() > len(indent) {
+			if breakAt > len(indent) {
+				flush(breakAt)
+			} else {
+				flush(current.Len())
+			}
+		}
+		if r == ' ' || w == 2 {
+			breakAt = current.Len()
+		}
+		current.WriteRune(r)
+		used += w
+		if r == ' ' {
+			breakAt = current.Len()
+		}
+	}
+	if rest := strings.TrimRight(current.String(), " "); strings.TrimSpace(rest) != "" {
+		lines = append(lines, rest)
+	}
+	return lines
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDisplayWidth(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"fix: typo", 9},
+		{"修正", 4},
+		{"fix: 誤字を修正", 15},
+	}
+	for _, tt := range tests {
+		if got := displayWidth(tt.text); got != tt.want {
+			t.Errorf("displayWidth(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateSubject(t *testing.T) {
+	tests := []struct {
+		subject string
+		limit   int
+		want    string
+	}{
+		{"fix: handle an empty cache when the repository has no commits", 30, "fix: handle an empty cache…"},
+		{"fix: handle_an_empty_cache_when_the_repository", 20, "fix: handle_an_empt…"},
+		{"修正: キャッシュが空のときの処理", 12, "修正: キャ…"},
+	}
+	for _, tt := range tests {
+		got := truncateSubject(tt.subject, tt.limit)
+		if got != tt.want {
+			t.Errorf("truncateSubject(%q, %d) = %q, want %q", tt.subject, tt.limit, got, tt.want)
+		}
+		if displayWidth(got) > tt.limit {
+			t.Errorf("truncateSubject(%q, %d) is %d columns wide", tt.subject, tt.limit, displayWidth(got))
+		}
+	}
+}
+
+func TestWrapBody(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		column int
+		want   string
+	}{
+		{
+			name:   "paragraph",
+			body:   "The cache is keyed by the diff, so the same staged changes reuse the message.",
+			column: 30,
+			want:   "The cache is keyed by the\ndiff, so the same staged\nchanges reuse the message.",
+		},
+		{
+			name:   "list item",
+			body:   "- keep the header of the patch when truncating",
+			column: 20,
+			want:   "- keep the header\n  of the patch when\n  truncating",
+		},
+		{
+			name:   "untouched lines",
+			body:   "    indented code that is far too long to fit\nRefs: https://example.com/a/very/long/issue/url\nhttps://example.com/a/very/long/url/on/its/own",
+			column: 20,
+			want:   "    indented code that is far too long to fit\nRefs: https://example.com/a/very/long/issue/url\nhttps://example.com/a/very/long/url/on/its/own",
+		},
+		{
+			name:   "fenced code",
+			body:   "```\nfmt.Println(\"a line longer than the column\")\n```",
+			column: 20,
+			want:   "```\nfmt.Println(\"a line longer than the column\")\n```",
+		},
+		{
+			name:   "Japanese",
+			body:   "差分が大きいときはファイルごとに要約する",
+			column: 20,
+			want:   "差分が大きいときは\nファイルごとに要約\nする",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wrapBody(tt.body, tt.column); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		limit   int
+		column  int
+		want    string
+	}{
+		{"subject only", "  fix: typo  \n", 50, 72, "fix: typo"},
+		{"blank line before the body", "fix: typo\n\n\nIn the README.\n\n", 50, 72, "fix: typo\n\nIn the README."},
+		{
+			name:    "long subject moves to the body",
+			message: "fix: handle an empty cache when the repository has no commits",
+			limit:   30,
+			column:  72,
+			want:    "fix: handle an empty cache…\n\nfix: handle an empty cache when the repository has no commits",
+		},
+		{
+			name:    "limits disabled",
+			message: "fix: handle an empty cache when the repository has no commits\n\n" + strings.Repeat("word ", 30),
+			want:    "fix: handle an empty cache when the repository has no commits\n\n" + strings.TrimSpace(strings.Repeat("word ", 30)),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatMessage(tt.message, tt.limit, tt.column); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// generatedPatterns match the paths of common generated files: protobuf
+// and gRPC stubs, mocks, bundles and API client output.
+var generatedPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\.pb(\.gw)?\.go$`),
+	regexp.MustCompile(`_pb2(_grpc)?\.pyi?$`),
+	regexp.MustCompile(`\.pb\.(cc|h|swift|dart)$`),
+	regexp.MustCompile(`_pb\.(js|d\.ts)$`),
+	regexp.MustCompile(`(^|/)mock_[^/]*\.go$`),
+	regexp.MustCompile(`_mock\.go$`),
+	regexp.MustCompile(`(^|/)mocks?/`),
+	regexp.MustCompile(`(^|/)zz_generated\.[^/]*$`),
+	regexp.MustCompile(`\.(g|freezed)\.dart$`),
+	regexp.MustCompile(`(^|/)dist/`),
+	regexp.MustCompile(`\.min\.(js|css)$`),
+	regexp.MustCompile(`\.bundle\.js$`),
+	regexp.MustCompile(`\.js\.map$`),
+	regexp.MustCompile(`\.swagger\.(json|yaml)$`),
+	regexp.MustCompile(`(^|/)docs/(docs\.go|swagger\.(json|yaml))$`),
+}
+
+// generatedMarker matches the header that tools put in generated sources,
+// e.g. "// Code generated by protoc-gen-go. DO NOT EDIT." or "@generated".
+var generatedMarker = regexp.MustCompile(`(?m)^.*(Code generated .* DO NOT EDIT\.|@generated\b)`)
+
+const generatedHeaderBytes = 1024 // Where the generated marker is looked for
+
+const maxGeneratedDiffLines = 20000 // Larger files only report line counts
+
+// isGenerated reports whether a file is generated, by its linguist-generated
+// attribute, its path or a marker in the first lines of either version.
+func (g *CommitMessageGenerator) isGenerated(filePath string, contents ...string) bool {
+	if g.attributes != nil {
+		attrs, _ := g.attributes.Match(strings.Split(filePath, "/"), []string{"linguist-generated"})
+		if attr, ok := attrs["linguist-generated"]; ok {
+			return attr.IsSet() || attr.Value() == "true"
+		}
+	}
+
+	for _, pattern := range generatedPatterns {
+		if pattern.MatchString(filePath) {
+			return true
+		}
+	}
+
+	for _, content := range contents {
+		if len(content) > generatedHeaderBytes {
+			content = content[:generatedHeaderBytes]
+		}
+		if generatedMarker.MatchString(content) {
+			return true
+		}
+	}
+	return false
+}
+
+// generatedPatch replaces the diff of a generated file with a one-line
+// summary, keeping the token budget for hand-written code.
+func generatedPatch(filePath string, oldContent string, newContent string) FilePatch {
+	var change string
+	switch {
+	case oldContent == "":
+		change = fmt.Sprintf("added, %d lines", countLines(newContent))
+	case newContent == "":
+		change = fmt.Sprintf("deleted, %d lines", countLines(oldContent))
+	default:
+		added, removed := diffLineCounts(oldContent, newContent)
+		change = fmt.Sprintf("+%d -%d lines", added, removed)
+	}
+	return FilePatch{
+		Path:  filePath,
+		Patch: fmt.Sprintf("Generated file: %s (%s)\n", filePath, change),
+	}
+}
+
+func countLines(content string) int {
+	return len(difflib.SplitLines(content))
+}
+
+// diffLineCounts counts added and removed lines. For very large files it
+// only compares the line counts.
+func diffLineCounts(oldContent string, newContent string) (int, int) {
+	a, b := difflib.SplitLines(oldContent), difflib.SplitLines(newContent)
+	if len(a) > maxGeneratedDiffLines || len(b) > maxGeneratedDiffLines {
+		if len(b) > len(a) {
+			return len(b) - len(a), 0
+		}
+		return 0, len(a) - len(b)
+	}
+
+	var added, removed int
+	for _, op := range difflib.NewMatcher(a, b).GetOpCodes() {
+		switch op.Tag {
+		case 'r':
+			removed += op.I2 - op.I1
+			added += op.J2 - op.J1
+		case 'd':
+			removed += op.I2 - op.I1
+		case 'i':
+			added += op.J2 - op.J1
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// gitmoji is the emoji for a change type, see https://gitmoji.dev.
+type gitmoji struct {
+	Unicode   string
+	Shortcode string
+}
+
+var defaultGitmojis = map[string]gitmoji{
+	"feat":     {"✨", ":sparkles:"},
+	"fix":      {"🐛", ":bug:"},
+	"docs":     {"📝", ":memo:"},
+	"style":    {"🎨", ":art:"},
+	"refactor": {"♻️", ":recycle:"},
+	"perf":     {"⚡️", ":zap:"},
+	"test":     {"✅", ":white_check_mark:"},
+	"build":    {"📦", ":package:"},
+	"ci":       {"👷", ":construction_worker:"},
+	"chore":    {"🔧", ":wrench:"},
+	"revert":   {"⏪", ":rewind:"},
+}
+
+const gitmojiPrompt = `
+
+# 変更の種類
+
+1行目は ` + "`type: 要約`" + ` の形式で始めること。type は %s のいずれかとし、ツールが対応する絵文字に置き換える。
+`
+
+// gitmojiFor returns the emoji for a change type: the -gitmoji-map
+// entry when there is one, otherwise the default in the chosen notation.
+func (o Options) gitmojiFor(changeType string) string {
+	if emoji, ok := o.GitmojiMap[changeType]; ok {
+		return emoji
+	}
+	emoji, ok := defaultGitmojis[changeType]
+	if !ok {
+		return ""
+	}
+	if o.GitmojiCodes {
+		return emoji.Shortcode
+	}
+	return emoji.Unicode
+}
+
+// applyGitmoji prefixes the subject with the emoji of the change type. A
+// Conventional Commits header is kept after the emoji; the bare "type: "
+// asked for by gitmojiPrompt is replaced by it. structured, when set,
+// supplies the type.
+func (o Options) applyGitmoji(message string, structured *StructuredMessage) string {
+	m := conventionalHeader.FindStringSubmatch(strings.SplitN(message, "\n", 2)[0])
+	switch {
+	case o.Conventional && m != nil:
+		if emoji := o.gitmojiFor(m[1]); emoji != "" {
+			return emoji + " " + message
+		}
+	case structured != nil:
+		if emoji := o.gitmojiFor(strings.TrimSpace(structured.Type)); emoji != "" {
+			return emoji + " " + message
+		}
+	case m != nil:
+		if emoji := o.gitmojiFor(m[1]); emoji != "" {
+			return emoji + " " + strings.TrimPrefix(message, m[1]+m[2]+m[4]+": ")
+		}
+	}
+	return message
+}
+
+// mapFlag collects repeated KEY=VALUE flags, each possibly holding a
+// comma-separated list.
+type mapFlag map[string]string
+
+func (f *mapFlag) String() string {
+	var parts []string
+	for k, v := range *f {
+		parts = append(parts, k+"="+v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (f *mapFlag) Type() string {
+	return "key=value"
+}
+
+func (f *mapFlag) Set(value string) error {
+	if *f == nil {
+		*f = map[string]string{}
+	}
+	for _, pair := range strings.Split(value, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if !ok || k == "" || v == "" {
+			return fmt.Errorf("want KEY=VALUE, got %q", pair)
+		}
+		(*f)[k] = v
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+const maxGoSummaryLines = 30 // Declaration changes listed per file
+
+// goDecl is a top-level declaration: its signature, and its full source
+// to tell whether anything else changed.
+type goDecl struct {
+	Signature string
+	Source    string
+}
+
+// parseGoDecls returns the top-level functions, methods and types of a Go
+// file keyed by name ("Recv.Method" for methods).
+func parseGoDecls(content string) (map[string]goDecl, bool) {
+	decls := map[string]goDecl{}
+	if content == "" {
+		return decls, true
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, false
+	}
+
+	source := func(node ast.Node) string {
+		return content[fset.Position(node.Pos()).Offset:fset.Position(node.End()).Offset]
+	}
+	printNode := func(node any) string {
+		var b bytes.Buffer
+		if err := printer.Fprint(&b, fset, node); err != nil {
+			return ""
+		}
+		return b.String()
+	}
+
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			name := d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				name = receiverName(d.Recv.List[0].Type) + "." + name
+			}
+			signature := *d
+			signature.Body = nil
+			signature.Doc = nil
+			decls[name] = goDecl{Signature: printNode(&signature), Source: source(d)}
+		case *ast.GenDecl:
+			if d.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range d.Specs {
+				ts := spec.(*ast.TypeSpec)
+				decls[ts.Name.Name] = goDecl{Signature: "type " + ts.Name.Name, Source: printNode(ts)}
+			}
+		}
+	}
+	return decls, true
+}
+
+func receiverName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(t.X)
+	case *ast.IndexExpr:
+		return receiverName(t.X)
+	case *ast.IndexListExpr:
+		return receiverName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return "?"
+}
+
+// goChangeSummary lists the declarations a change to a Go file adds,
+// removes or modifies. It returns "" when either version does not parse
+// or no declaration changed.
+func goChangeSummary(oldContent string, newContent string) string {
+	before, ok := parseGoDecls(oldContent)
+	if !ok {
+		return ""
+	}
+	after, ok := parseGoDecls(newContent)
+	if !ok {
+		return ""
+	}
+
+	var lines []string
+	for name, decl := range after {
+		old, found := before[name]
+		switch {
+		case !found:
+			lines = append(lines, "added "+decl.Signature)
+		case old.Signature != decl.Signature:
+			lines = append(lines, fmt.Sprintf("changed signature %s → %s", old.Signature, decl.Signature))
+		case old.Source != decl.Source:
+			lines = append(lines, "modified "+decl.Signature)
+		}
+	}
+	for name, decl := range before {
+		if _, found := after[name]; !found {
+			lines = append(lines, "removed "+decl.Signature)
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+
+	sort.Strings(lines)
+	if len(lines) > maxGoSummaryLines {
+		lines = append(lines[:maxGoSummaryLines], fmt.Sprintf("... and %d more", len(lines)-maxGoSummaryLines))
+	}
+
+	var b strings.Builder
+	b.WriteString("Go declarations:\n")
+	for _, line := range lines {
+		b.WriteString("  " + strings.ReplaceAll(line, "\n", " ") + "\n")
+	}
+	return b.String()
+}
+
+// withGoSummary puts the declaration summary of a Go file right after the
+// "diff --git" line, so that it survives truncation of the hunks.
+func withGoSummary(filePath string, patch string, oldContent string, newContent string) string {
+	if !strings.HasSuffix(filePath, ".go") {
+		return patch
+	}
+	summary := goChangeSummary(oldContent, newContent)
+	if summary == "" {
+		return patch
+	}
+
+	header, rest, _ := strings.Cut(patch, "\n")
+	return header + "\n" + summary + rest
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// shallowParents returns the parents of the commits at the boundary of a
+// shallow clone. They are not in the object database, so history walks
+// must not try to load them.
+func shallowParents(repo *git.Repository) []plumbing.Hash {
+	shallow, err := repo.Storer.Shallow()
+	if err != nil || len(shallow) == 0 {
+		return nil
+	}
+
+	var parents []plumbing.Hash
+	for _, hash := range shallow {
+		c, err := repo.CommitObject(hash)
+		if err != nil {
+			continue
+		}
+		parents = append(parents, c.ParentHashes...)
+	}
+	return parents
+}
+
+// isShallow reports whether the repository is a shallow clone.
+func isShallow(repo *git.Repository) bool {
+	shallow, err := repo.Storer.Shallow()
+	return err == nil && len(shallow) > 0
+}
+
+// walkHistory iterates over the commits reachable from c, newest first,
+// skipping those in seen. In a shallow clone it stops at the boundary and
+// yields whatever history exists instead of failing.
+func walkHistory(repo *git.Repository, c *object.Commit, seen map[plumbing.Hash]bool) object.CommitIter {
+	return object.NewCommitPreorderIter(c, seen, shallowParents(repo))
+}
+
+// headCommit returns the commit HEAD points to, or nil when there is none.
+func (g *CommitMessageGenerator) headCommit() *object.Commit {
+	head, err := g.repo.Head()
+	if err != nil {
+		return nil
+	}
+	c, err := g.repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil
+	}
+	return c
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+)
+
+const hookMarker = "# installed by autogcm"
+
+// prepareCommitMsgHook hands git's arguments to `autogcm hook`. A failure
+// must never stop the commit, so its status is ignored.
+const prepareCommitMsgHook = `#!/bin/sh
+` + hookMarker + `
+# Pre-fill the commit message; see autogcm hook.
+autogcm hook "$@" || true
+`
+
+// hooksDir returns where git looks for hooks: core.hooksPath, relative to
+// the worktree root, or the hooks directory shared by all worktrees.
+func hooksDir(repo *git.Repository) (string, error) {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return "", fmt.Errorf("getting worktree: %w", err)
+	}
+
+	hooksPath := ""
+	if cfg, err := repo.Config(); err == nil {
+		hooksPath = cfg.Raw.Section("core").Option("hooksPath")
+	}
+	if hooksPath == "" {
+		if cfg, err := config.LoadConfig(config.GlobalScope); err == nil {
+			hooksPath = cfg.Raw.Section("core").Option("hooksPath")
+		}
+	}
+	if hooksPath != "" {
+		if rest, ok := strings.CutPrefix(hooksPath, "~/"); ok {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", fmt.Errorf("expanding core.hooksPath: %w", err)
+			}
+			hooksPath = filepath.Join(home, rest)
+		}
+		if !filepath.IsAbs(hooksPath) {
+			hooksPath = filepath.Join(worktree.Filesystem.Root(), hooksPath)
+		}
+		return hooksPath, nil
+	}
+
+	common := (&CommitMessageGenerator{repo: repo}).commonDir()
+	if common == "" {
+		return "", fmt.Errorf("repository has no git directory on disk")
+	}
+	return filepath.Join(common, "hooks"), nil
+}
+
+// installHook writes the prepare-commit-msg hook into the repository's
+// hooks directory, refusing to overwrite a hook it did not install.
+func installHook(repo *git.Repository) (string, error) {
+	dir, err := hooksDir(repo)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, "prepare-commit-msg")
+	if existing, err := os.ReadFile(path); err == nil && !strings.Contains(string(existing), hookMarker) {
+		return "", fmt.Errorf("%s already exists and was not installed by autogcm", path)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("creating hooks directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(prepareCommitMsgHook), 0o755); err != nil {
+		return "", fmt.Errorf("writing hook: %w", err)
+	}
+
+	return path, nil
+}
+
+// uninstallHook removes the prepare-commit-msg hook, leaving one it did not
+// install alone.
+func uninstallHook(repo *git.Repository) (string, error) {
+	dir, err := hooksDir(repo)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, "prepare-commit-msg")
+	existing, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("no prepare-commit-msg hook in %s", dir)
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading hook: %w", err)
+	}
+	if !strings.Contains(string(existing), hookMarker) {
+		return "", fmt.Errorf("%s was not installed by autogcm", path)
+	}
+	if err := os.Remove(path); err != nil {
+		return "", fmt.Errorf("removing hook: %w", err)
+	}
+	return path, nil
+}
+
+// runHookCommand implements `autogcm install-hook` and `uninstall-hook`.
+func runHookCommand(options Options, command string, out io.Writer) error {
+	repo, err := openRepository(options.Dir)
+	if err != nil {
+		return gitError{fmt.Errorf("opening repository: %w", err)}
+	}
+	if command == "install-hook" {
+		path, err := installHook(repo)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Installed hook at %s.\n", path)
+		return nil
+	}
+	path, err := uninstallHook(repo)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Removed hook at %s.\n", path)
+	return nil
+}
+
+// hookNeedsMessage reports whether the hook should fill in the message file
+// at path: only when git opens the editor on an empty message. A source
+// (message for -m and -F, template, merge, squash or commit) means git has
+// already provided one, and so does any line in the file that is not a
+// comment.
+func hookNeedsMessage(dir string, path string, source string) (bool, error) {
+	if source != "" {
+		return false, nil
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("reading commit message file: %w", err)
+	}
+
+	comment := "#"
+	if repo, err := openRepository(dir); err == nil {
+		if cfg, err := repo.ConfigScoped(config.GlobalScope); err == nil {
+			if c := cfg.Raw.Section("core").Option("commentChar"); c != "" && c != "auto" {
+				comment = c
+			}
+		}
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.HasPrefix(line, comment+" ------------------------ >8 ------------------------") {
+			break // git commit -v: the diff below is not part of the message
+		}
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, comment) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// writeHookMessage puts message at the top of the commit message file git
+// passed to the hook, above the comments git wrote there.
+func writeHookMessage(path string, message string) error {
+	existing, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("reading commit message file: %w", err)
+	}
+	// Replace the file in one step so git never sees it half written.
+	tmp := path + ".autogcm"
+	if err := os.WriteFile(tmp, []byte(message+"\n"+string(existing)), 0o644); err != nil {
+		return fmt.Errorf("writing commit message file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("writing commit message file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+const ignoreFile = ".autogcmignore"
+
+// loadIgnore reads .autogcmignore from the worktree root. It uses gitignore
+// syntax and lists files that are never sent to the model, such as
+// fixtures, snapshots and generated code, without ignoring them in git.
+func loadIgnore(worktree *git.Worktree) (gitignore.Matcher, error) {
+	if worktree == nil {
+		return nil, nil
+	}
+
+	f, err := worktree.Filesystem.Open(ignoreFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", ignoreFile, err)
+	}
+	defer f.Close()
+
+	var patterns []gitignore.Pattern
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, gitignore.ParsePattern(line, nil))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", ignoreFile, err)
+	}
+
+	return gitignore.NewMatcher(patterns), nil
+}
+
+// dropIgnored removes the patches of files matched by .autogcmignore.
+func (g *CommitMessageGenerator) dropIgnored(patches []FilePatch) []FilePatch {
+	if g.ignore == nil {
+		return patches
+	}
+
+	var kept []FilePatch
+	for _, p := range patches {
+		if p.Path != "" && g.ignore.Match(strings.Split(p.Path, "/"), false) {
+			continue
+		}
+		kept = append(kept, p)
+	}
+	return kept
+}
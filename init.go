@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/term"
+)
+
+const sampleDiff = `diff --git a/hello.go b/hello.go
+--- a/hello.go
++++ b/hello.go
+@@ -1,5 +1,5 @@
+ package main
+
+ func greeting() string {
+-	return "Hello"
++	return "Hello, world"
+ }
+`
+
+// runInit walks the user through setting API keys, installing the git hook
+// and checking that a message can be generated.
+func runInit(ctx context.Context, options Options, in io.Reader, out io.Writer) error {
+	reader := bufio.NewReader(in)
+
+	shell, rcFile := detectShell()
+	fmt.Fprintf(out, "Detected shell: %s (%s)\n", shell, rcFile)
+
+	appended := false // Whether rcFile needs to be sourced
+	for _, provider := range []string{"groq", "openai"} {
+		key := providerKeyEnvs[provider]
+		if newCredential(key, provider).Configured() {
+			fmt.Fprintf(out, "%s is already set.\n", key)
+			continue
+		}
+
+		value, err := readSecret(reader, in, out, fmt.Sprintf("Enter %s (leave empty to skip): ", key))
+		if err != nil {
+			return err
+		}
+		if value == "" {
+			continue
+		}
+		os.Setenv(key, value)
+
+		if confirm(reader, out, fmt.Sprintf("Store the %s key in the OS keychain?", provider)) {
+			if err := keyring.Set(keyringService, provider, value); err != nil {
+				return fmt.Errorf("storing key in keychain: %w", err)
+			}
+			fmt.Fprintf(out, "Stored %s key in the OS keychain.\n", provider)
+			continue
+		}
+
+		if !confirm(reader, out, fmt.Sprintf("Append export of %s to %s?", key, rcFile)) {
+			continue
+		}
+		if err := appendExport(rcFile, shell, key, value); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Added %s to %s.\n", key, rcFile)
+		appended = true
+	}
+
+	repo, err := openRepository(options.Dir)
+	if err == nil && confirm(reader, out, "Install the prepare-commit-msg hook in this repository?") {
+		path, err := installHook(repo)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Installed hook at %s.\n", path)
+	}
+
+	fmt.Fprintln(out, "Verifying a test generation...")
+	prompt, _, err := loadSystemPrompt(options.SystemPrompt)
+	if err != nil {
+		return err
+	}
+	generator := &CommitMessageGenerator{
+		registry: newRegistry(options),
+		prompt:   prompt,
+		options:  options,
+		uncached: true,
+	}
+	result, err := generator.lazyGenerateCommitMessage(ctx, []FilePatch{{Path: "hello.go", Patch: sampleDiff}})
+	if err != nil {
+		return fmt.Errorf("test generation failed: %w", err)
+	}
+	fmt.Fprintf(out, "Test generation succeeded: %s\n", result.Message)
+	if appended {
+		fmt.Fprintf(out, "Restart your shell or run `source %s` to pick up the new settings.\n", rcFile)
+	}
+
+	return nil
+}
+
+// detectShell returns the user's shell name and its startup file.
+func detectShell() (string, string) {
+	home, _ := os.UserHomeDir()
+	shell := filepath.Base(os.Getenv("SHELL"))
+
+	switch shell {
+	case "zsh":
+		return shell, filepath.Join(home, ".zshrc")
+	case "fish":
+		return shell, filepath.Join(home, ".config", "fish", "config.fish")
+	case "bash":
+		return shell, filepath.Join(home, ".bashrc")
+	default:
+		return "sh", filepath.Join(home, ".profile")
+	}
+}
+
+func appendExport(rcFile string, shell string, key string, value string) error {
+	line := fmt.Sprintf("export %s='%s'\n", key, value)
+	if shell == "fish" {
+		line = fmt.Sprintf("set -gx %s '%s'\n", key, value)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(rcFile), 0o755); err != nil {
+		return fmt.Errorf("creating %s: %w", filepath.Dir(rcFile), err)
+	}
+	f, err := os.OpenFile(rcFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", rcFile, err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString("\n# autogcm\n" + line); err != nil {
+		return fmt.Errorf("writing %s: %w", rcFile, err)
+	}
+	return nil
+}
+
+func ask(reader *bufio.Reader, out io.Writer, prompt string) string {
+	fmt.Fprint(out, prompt)
+	line, _ := reader.ReadString('\n')
+	return strings.TrimSpace(line)
+}
+
+// readSecret asks for an API key. On a terminal the key is not echoed;
+// otherwise it is read as a line from reader.
+func readSecret(reader *bufio.Reader, in io.Reader, out io.Writer, prompt string) (string, error) {
+	f, ok := in.(*os.File)
+	if !ok || !isTerminal(f) {
+		return ask(reader, out, prompt), nil
+	}
+	fmt.Fprint(out, prompt)
+	key, err := term.ReadPassword(int(f.Fd()))
+	fmt.Fprintln(out)
+	if err != nil {
+		return "", fmt.Errorf("reading key: %w", err)
+	}
+	return strings.TrimSpace(string(key)), nil
+}
+
+func confirm(reader *bufio.Reader, out io.Writer, prompt string) bool {
+	answer := strings.ToLower(ask(reader, out, prompt+" [y/N] "))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const selectionFile = "autogcm-excluded.json" // Stored in the git directory
+
+var errAborted = errors.New("aborted by user")
+
+// splitHunks splits a patch into its header and its "@@" hunks.
+func splitHunks(patch string) (string, []string) {
+	lines := strings.SplitAfter(patch, "\n")
+
+	var header strings.Builder
+	var hunks []string
+	var current strings.Builder
+	for _, line := range lines {
+		if strings.HasPrefix(line, "@@") {
+			if current.Len() > 0 {
+				hunks = append(hunks, current.String())
+				current.Reset()
+			}
+			current.WriteString(line)
+			continue
+		}
+		if len(hunks) == 0 && current.Len() == 0 {
+			header.WriteString(line)
+			continue
+		}
+		current.WriteString(line)
+	}
+	if current.Len() > 0 {
+		hunks = append(hunks, current.String())
+	}
+
+	return header.String(), hunks
+}
+
+// selectPatches lets the user toggle files and hunks out of the prompt.
+// Files excluded here are remembered in the git directory and start out
+// excluded on the next run.
+func (g *CommitMessageGenerator) selectPatches(patches []FilePatch, in io.Reader, out io.Writer) ([]FilePatch, error) {
+	remembered := g.loadExcludedPaths()
+
+	type fileChoice struct {
+		patch    FilePatch
+		header   string
+		hunks    []string
+		included bool
+		hunkOn   []bool
+	}
+
+	choices := make([]*fileChoice, len(patches))
+	for i, p := range patches {
+		header, hunks := splitHunks(p.Patch)
+		c := &fileChoice{patch: p, header: header, hunks: hunks, included: !remembered[p.Path]}
+		c.hunkOn = make([]bool, len(hunks))
+		for j := range c.hunkOn {
+			c.hunkOn[j] = true
+		}
+		choices[i] = c
+	}
+
+	reader := bufio.NewReader(in)
+	for {
+		fmt.Fprintln(out, "Files to send:")
+		for i, c := range choices {
+			mark := " "
+			if c.included {
+				mark = "x"
+			}
+			enabled := 0
+			for _, on := range c.hunkOn {
+				if on {
+					enabled++
+				}
+			}
+			fmt.Fprintf(out, "  %2d [%s] %s (%d/%d hunks)\n", i+1, mark, c.patch.Path, enabled, len(c.hunks))
+		}
+		fmt.Fprint(out, "Toggle files by number, 'h N' to pick hunks of file N, Enter to continue, 'q' to abort: ")
+
+		line, err := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if err != nil && err != io.EOF {
+				return nil, fmt.Errorf("reading selection: %w", err)
+			}
+			break
+		}
+		if line == "q" {
+			return nil, errAborted
+		}
+
+		if rest, ok := strings.CutPrefix(line, "h "); ok {
+			n, convErr := strconv.Atoi(strings.TrimSpace(rest))
+			if convErr != nil || n < 1 || n > len(choices) {
+				fmt.Fprintln(out, "No such file.")
+				continue
+			}
+			c := choices[n-1]
+			selectHunks(reader, out, c.patch.Path, c.hunks, c.hunkOn)
+			continue
+		}
+
+		for _, field := range strings.Fields(line) {
+			n, convErr := strconv.Atoi(field)
+			if convErr != nil || n < 1 || n > len(choices) {
+				fmt.Fprintf(out, "Ignoring %q.\n", field)
+				continue
+			}
+			choices[n-1].included = !choices[n-1].included
+		}
+	}
+
+	var selected []FilePatch
+	excluded := map[string]bool{}
+	for path, on := range remembered {
+		excluded[path] = on
+	}
+	for _, c := range choices {
+		excluded[c.patch.Path] = !c.included
+		if !c.included {
+			continue
+		}
+
+		p := c.patch
+		if len(c.hunks) > 0 {
+			var patch strings.Builder
+			patch.WriteString(c.header)
+			kept := 0
+			for j, hunk := range c.hunks {
+				if c.hunkOn[j] {
+					patch.WriteString(hunk)
+					kept++
+				}
+			}
+			if kept == 0 {
+				continue
+			}
+			if kept < len(c.hunks) {
+				fmt.Fprintf(&patch, "... (%d hunk(s) omitted by the user) ...\n", len(c.hunks)-kept)
+			}
+			p.Patch = patch.String()
+		}
+		selected = append(selected, p)
+	}
+
+	if err := g.saveExcludedPaths(excluded); err != nil {
+		fmt.Fprintf(out, "Warning: could not remember selection: %v\n", err)
+	}
+
+	return selected, nil
+}
+
+func selectHunks(reader *bufio.Reader, out io.Writer, path string, hunks []string, on []bool) {
+	for {
+		fmt.Fprintf(out, "Hunks of %s:\n", path)
+		for i, hunk := range hunks {
+			mark := " "
+			if on[i] {
+				mark = "x"
+			}
+			header, _, _ := strings.Cut(hunk, "\n")
+			fmt.Fprintf(out, "  %2d [%s] %s %s\n", i+1, mark, header, firstChangedLine(hunk))
+		}
+		fmt.Fprint(out, "Toggle hunks by number, Enter to go back: ")
+
+		line, _ := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" {
+			return
+		}
+		for _, field := range strings.Fields(line) {
+			n, err := strconv.Atoi(field)
+			if err != nil || n < 1 || n > len(hunks) {
+				fmt.Fprintf(out, "Ignoring %q.\n", field)
+				continue
+			}
+			on[n-1] = !on[n-1]
+		}
+	}
+}
+
+func firstChangedLine(hunk string) string {
+	for _, line := range strings.Split(hunk, "\n")[1:] {
+		if strings.HasPrefix(line, "+") || strings.HasPrefix(line, "-") {
+			if runes := []rune(line); len(runes) > 60 {
+				line = string(runes[:60]) + "…"
+			}
+			return line
+		}
+	}
+	return ""
+}
+
+func (g *CommitMessageGenerator) selectionPath() string {
+	dir := g.gitDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, selectionFile)
+}
+
+func (g *CommitMessageGenerator) loadExcludedPaths() map[string]bool {
+	excluded := map[string]bool{}
+
+	path := g.selectionPath()
+	if path == "" {
+		return excluded
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return excluded
+	}
+
+	var paths []string
+	if err := json.Unmarshal(data, &paths); err != nil {
+		return excluded
+	}
+	for _, p := range paths {
+		excluded[p] = true
+	}
+	return excluded
+}
+
+func (g *CommitMessageGenerator) saveExcludedPaths(excluded map[string]bool) error {
+	path := g.selectionPath()
+	if path == "" {
+		return nil
+	}
+
+	paths := []string{}
+	for p, on := range excluded {
+		if on {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	data, err := json.MarshalIndent(paths, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding selection: %w", err)
+	}
+	return os.WriteFile(path, data, 0o644)
+}
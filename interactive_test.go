@@ -0,0 +1,27 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFirstChangedLine(t *testing.T) {
+	long := "+" + strings.Repeat("変更", 40)
+	tests := []struct {
+		name string
+		hunk string
+		want string
+	}{
+		{"added line", "@@ -1 +1,2 @@\n context\n+added\n", "+added"},
+		{"removed line", "@@ -1,2 +1 @@\n-removed\n+added\n", "-removed"},
+		{"no change", "@@ -1 +1 @@\n context\n", ""},
+		{"cut by rune", "@@ -0,0 +1 @@\n" + long + "\n", string([]rune(long)[:60]) + "…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := firstChangedLine(tt.hunk); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	flag "github.com/spf13/pflag"
+)
+
+const langPrompt = `
+
+# 言語
+
+コミットメッセージは必ず %s で書くこと。差分やコードコメント、過去のコミットメッセージがどの言語で書かれていても、この指定はこれまでの条件より優先する。
+`
+
+func defaultLang() string {
+	return os.Getenv("AUTOGCM_LANG")
+}
+
+// langContext forces the language of the message for -lang.
+func langContext(lang string) string {
+	if lang == "" {
+		return ""
+	}
+	return fmt.Sprintf(langPrompt, languageName(lang))
+}
+
+// flagSet reports whether the named flag was given on the command line.
+func flagSet(name string) bool {
+	f := flag.Lookup(name)
+	return f != nil && f.Changed
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// endpointProvider is implemented by providers that talk to an HTTP
+// endpoint. Providers that do not say where they send requests are taken
+// to be cloud services by -local-only.
+type endpointProvider interface {
+	Endpoint() string
+}
+
+// isLocal reports whether p sends its requests to this machine.
+func isLocal(p Provider) bool {
+	e, ok := p.(endpointProvider)
+	if !ok {
+		return false
+	}
+	u, err := url.Parse(e.Endpoint())
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// localOnlyDial wraps dial so that it only connects to loopback addresses,
+// whatever host a provider, a redirect or an update asks for. Names are
+// resolved first and dialed by address, so a name cannot resolve to a
+// loopback address when checked and to another one when dialed.
+func localOnlyDial(dial func(ctx context.Context, network string, addr string) (net.Conn, error)) func(ctx context.Context, network string, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range addrs {
+			if a.IP.IsLoopback() {
+				return dial(ctx, network, net.JoinHostPort(a.IP.String(), port))
+			}
+		}
+		return nil, fmt.Errorf("-local-only: refusing to connect to %s, which is not on this machine", host)
+	}
+}
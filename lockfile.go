@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const maxLockfileChanges = 10 // Package changes listed by name in a summary
+
+// lockfileParsers read the resolved package versions from a lockfile,
+// keyed by file name.
+var lockfileParsers = map[string]func(content string) (map[string]string, error){
+	"go.sum":              parseGoSum,
+	"package-lock.json":   parsePackageLock,
+	"npm-shrinkwrap.json": parsePackageLock,
+	"yarn.lock":           parseYarnLock,
+	"pnpm-lock.yaml":      parsePnpmLock,
+	"Cargo.lock":          parseTOMLLock,
+	"poetry.lock":         parseTOMLLock,
+	"uv.lock":             parseTOMLLock,
+	"Gemfile.lock":        parseGemfileLock,
+	"composer.lock":       parseComposerLock,
+}
+
+// summarizeLockfile describes a lockfile change as the packages that were
+// added, removed or updated, instead of a diff that can run to thousands of
+// lines. It returns false when the file is not a known lockfile or cannot
+// be parsed.
+func summarizeLockfile(filePath string, oldContent string, newContent string) (string, bool) {
+	parse, ok := lockfileParsers[path.Base(filePath)]
+	if !ok {
+		return "", false
+	}
+
+	before, err := parse(oldContent)
+	if err != nil {
+		return "", false
+	}
+	after, err := parse(newContent)
+	if err != nil {
+		return "", false
+	}
+
+	var added, removed, updated []string
+	for name, version := range after {
+		old, found := before[name]
+		switch {
+		case !found:
+			added = append(added, fmt.Sprintf("%s %s", name, version))
+		case old != version:
+			updated = append(updated, fmt.Sprintf("%s %s→%s", name, old, version))
+		}
+	}
+	for name, version := range before {
+		if _, found := after[name]; !found {
+			removed = append(removed, fmt.Sprintf("%s %s", name, version))
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Lockfile %s: %d packages updated, %d added, %d removed\n", filePath, len(updated), len(added), len(removed))
+	for _, group := range []struct {
+		label   string
+		entries []string
+	}{{"updated", updated}, {"added", added}, {"removed", removed}} {
+		if len(group.entries) == 0 {
+			continue
+		}
+		sort.Strings(group.entries)
+		shown := group.entries
+		if len(shown) > maxLockfileChanges {
+			shown = shown[:maxLockfileChanges]
+		}
+		fmt.Fprintf(&b, "  %s: %s", group.label, strings.Join(shown, ", "))
+		if more := len(group.entries) - len(shown); more > 0 {
+			fmt.Fprintf(&b, " and %d more", more)
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String(), true
+}
+
+// parseGoSum reads "module version[/go.mod] hash" lines. A module listed
+// with several versions keeps all of them.
+func parseGoSum(content string) (map[string]string, error) {
+	versions := map[string][]string{}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || strings.HasSuffix(fields[1], "/go.mod") {
+			continue
+		}
+		versions[fields[0]] = append(versions[fields[0]], fields[1])
+	}
+
+	packages := map[string]string{}
+	for module, v := range versions {
+		sort.Strings(v)
+		packages[module] = strings.Join(v, ",")
+	}
+	return packages, nil
+}
+
+func parsePackageLock(content string) (map[string]string, error) {
+	packages := map[string]string{}
+	if content == "" {
+		return packages, nil
+	}
+
+	var lock struct {
+		Packages     map[string]struct{ Version string } `json:"packages"`
+		Dependencies map[string]json.RawMessage          `json:"dependencies"`
+	}
+	if err := json.Unmarshal([]byte(content), &lock); err != nil {
+		return nil, err
+	}
+
+	// lockfileVersion 2 and 3 list every installed package by path.
+	for key, pkg := range lock.Packages {
+		i := strings.LastIndex(key, "node_modules/")
+		if i < 0 || pkg.Version == "" {
+			continue // The root package or a workspace
+		}
+		name := key[i+len("node_modules/"):]
+		packages[name] = pkg.Version
+	}
+	if len(lock.Packages) > 0 {
+		return packages, nil
+	}
+
+	// lockfileVersion 1 nests dependencies.
+	var walk func(deps map[string]json.RawMessage) error
+	walk = func(deps map[string]json.RawMessage) error {
+		for name, raw := range deps {
+			var dep struct {
+				Version      string                     `json:"version"`
+				Dependencies map[string]json.RawMessage `json:"dependencies"`
+			}
+			if err := json.Unmarshal(raw, &dep); err != nil {
+				return err
+			}
+			packages[name] = dep.Version
+			if err := walk(dep.Dependencies); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return packages, walk(lock.Dependencies)
+}
+
+// parseYarnLock reads both the classic and the Berry (YAML) formats: an
+// unindented header naming the package ranges, then an indented version.
+func parseYarnLock(content string) (map[string]string, error) {
+	packages := map[string]string{}
+	var names []string
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case !strings.HasPrefix(line, " "):
+			names = nil
+			for _, spec := range strings.Split(strings.TrimSuffix(line, ":"), ", ") {
+				spec = strings.Trim(spec, `"`)
+				if i := strings.LastIndex(spec, "@"); i > 0 {
+					names = append(names, spec[:i])
+				}
+			}
+		case strings.HasPrefix(line, "  version"):
+			version := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "version"))
+			version = strings.Trim(strings.TrimPrefix(version, ":"), ` "`)
+			for _, name := range names {
+				packages[name] = version
+			}
+		}
+	}
+	return packages, scanner.Err()
+}
+
+// pnpmPackage matches package keys such as "/react@18.2.0:",
+// "/@types/node/20.1.0:" or "react@18.2.0(peer@1.0.0):".
+var pnpmPackage = regexp.MustCompile(`^  ['"]?/?((?:@[^/@\s]+/)?[^/@\s'"(]+)[@/]([0-9][^:'"(\s]*)`)
+
+func parsePnpmLock(content string) (map[string]string, error) {
+	packages := map[string]string{}
+	for _, line := range strings.Split(content, "\n") {
+		if m := pnpmPackage.FindStringSubmatch(line); m != nil {
+			packages[m[1]] = m[2]
+		}
+	}
+	return packages, nil
+}
+
+// parseTOMLLock reads the [[package]] tables of Cargo.lock, poetry.lock
+// and uv.lock.
+func parseTOMLLock(content string) (map[string]string, error) {
+	packages := map[string]string{}
+	var name string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "[[package]]":
+			name = ""
+		case strings.HasPrefix(line, "name = "):
+			name = strings.Trim(strings.TrimPrefix(line, "name = "), `"`)
+		case strings.HasPrefix(line, "version = ") && name != "":
+			packages[name] = strings.Trim(strings.TrimPrefix(line, "version = "), `"`)
+		}
+	}
+	return packages, nil
+}
+
+// gemSpec matches "    name (version)" entries under specs:.
+var gemSpec = regexp.MustCompile(`^    ([^\s(]+) \(([^)]+)\)$`)
+
+func parseGemfileLock(content string) (map[string]string, error) {
+	packages := map[string]string{}
+	for _, line := range strings.Split(content, "\n") {
+		if m := gemSpec.FindStringSubmatch(line); m != nil {
+			packages[m[1]] = m[2]
+		}
+	}
+	return packages, nil
+}
+
+func parseComposerLock(content string) (map[string]string, error) {
+	packages := map[string]string{}
+	if content == "" {
+		return packages, nil
+	}
+
+	var lock struct {
+		Packages    []struct{ Name, Version string } `json:"packages"`
+		PackagesDev []struct{ Name, Version string } `json:"packages-dev"`
+	}
+	if err := json.Unmarshal([]byte(content), &lock); err != nil {
+		return nil, err
+	}
+	for _, pkg := range append(lock.Packages, lock.PackagesDev...) {
+		packages[pkg.Name] = pkg.Version
+	}
+	return packages, nil
+}
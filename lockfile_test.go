@@ -0,0 +1,185 @@
+package main
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestLockfileParsers(t *testing.T) {
+	tests := []struct {
+		file    string
+		content string
+		want    map[string]string
+	}{
+		{
+			file: "go.sum",
+			content: `github.com/pmezard/go-difflib v1.0.0 h1:4DBwDE0NGyQoBHbLQYPwSUPoCMWR5BEzIk/f1lZbAQM=
+github.com/pmezard/go-difflib v1.0.0/go.mod h1:iKH77koFhYxTK1pcRnkKkqfTogsbg7gZNVY4sRDYZ/4=
+gopkg.in/yaml.v3 v3.0.0 h1:hjy8E9ON/egN1tAYqKb61G10WtihqetD4sz2H+8nIeA=
+gopkg.in/yaml.v3 v3.0.1 h1:fxVm/GzAzEWqLHuvctI91KS9hhNmmWOoWu0XTYJS7CA=
+`,
+			want: map[string]string{
+				"github.com/pmezard/go-difflib": "v1.0.0",
+				"gopkg.in/yaml.v3":              "v3.0.0,v3.0.1",
+			},
+		},
+		{
+			file: "package-lock.json",
+			content: `{"lockfileVersion": 3, "packages": {
+				"": {"name": "app"},
+				"node_modules/react": {"version": "18.2.0"},
+				"node_modules/@types/node": {"version": "20.1.0"},
+				"node_modules/a/node_modules/b": {"version": "1.0.0"}
+			}}`,
+			want: map[string]string{"react": "18.2.0", "@types/node": "20.1.0", "b": "1.0.0"},
+		},
+		{
+			file: "package-lock.json",
+			content: `{"lockfileVersion": 1, "dependencies": {
+				"a": {"version": "1.0.0", "dependencies": {"b": {"version": "2.0.0"}}}
+			}}`,
+			want: map[string]string{"a": "1.0.0", "b": "2.0.0"},
+		},
+		{
+			file: "yarn.lock",
+			content: `# yarn lockfile v1
+
+"@babel/core@^7.0.0", "@babel/core@^7.1.0":
+  version "7.22.5"
+  resolved "https://registry.yarnpkg.com/@babel/core/-/core-7.22.5.tgz"
+
+lodash@^4.17.21:
+  version "4.17.21"
+`,
+			want: map[string]string{"@babel/core": "7.22.5", "lodash": "4.17.21"},
+		},
+		{
+			file: "yarn.lock",
+			content: `__metadata:
+  version: 6
+
+"lodash@npm:^4.17.21":
+  version: 4.17.21
+`,
+			want: map[string]string{"lodash": "4.17.21"},
+		},
+		{
+			file: "pnpm-lock.yaml",
+			content: `packages:
+  /react@18.2.0:
+    resolution: {integrity: sha512-x}
+  /@types/node/20.1.0:
+    dev: true
+  'vue@3.3.4(typescript@5.1.6)':
+    dev: false
+`,
+			want: map[string]string{"react": "18.2.0", "@types/node": "20.1.0", "vue": "3.3.4"},
+		},
+		{
+			file: "Cargo.lock",
+			content: `version = 3
+
+[[package]]
+name = "serde"
+version = "1.0.188"
+
+[[package]]
+name = "app"
+version = "0.1.0"
+dependencies = [
+ "serde",
+]
+`,
+			want: map[string]string{"serde": "1.0.188", "app": "0.1.0"},
+		},
+		{
+			file: "Gemfile.lock",
+			content: `GEM
+  remote: https://rubygems.org/
+  specs:
+    rack (3.0.8)
+    rails (7.0.6)
+      rack (>= 2.2.4)
+
+PLATFORMS
+  ruby
+`,
+			want: map[string]string{"rack": "3.0.8", "rails": "7.0.6"},
+		},
+		{
+			file:    "composer.lock",
+			content: `{"packages": [{"name": "monolog/monolog", "version": "3.4.0"}], "packages-dev": [{"name": "phpunit/phpunit", "version": "10.3.1"}]}`,
+			want:    map[string]string{"monolog/monolog": "3.4.0", "phpunit/phpunit": "10.3.1"},
+		},
+		{
+			file: "composer.lock",
+			want: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		got, err := lockfileParsers[tt.file](tt.content)
+		if err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+			continue
+		}
+		if !maps.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestSummarizeLockfile(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		old, new string
+		want     string // Empty when the file is not summarized
+	}{
+		{
+			name: "updated, added and removed",
+			path: "web/yarn.lock",
+			old:  "a@^1:\n  version \"1.0.0\"\nb@^1:\n  version \"1.0.0\"\n",
+			new:  "a@^1:\n  version \"1.1.0\"\nc@^2:\n  version \"2.0.0\"\n",
+			want: "Lockfile web/yarn.lock: 1 packages updated, 1 added, 1 removed\n" +
+				"  updated: a 1.0.0→1.1.0\n  added: c 2.0.0\n  removed: b 1.0.0\n",
+		},
+		{
+			name: "new lockfile",
+			path: "Cargo.lock",
+			new:  "[[package]]\nname = \"serde\"\nversion = \"1.0.0\"\n",
+			want: "Lockfile Cargo.lock: 0 packages updated, 1 added, 0 removed\n  added: serde 1.0.0\n",
+		},
+		{
+			name: "not a lockfile",
+			path: "go.mod",
+			old:  "module a\n",
+			new:  "module b\n",
+		},
+		{
+			name: "invalid JSON",
+			path: "package-lock.json",
+			old:  "{",
+			new:  "{}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := summarizeLockfile(tt.path, tt.old, tt.new)
+			if ok != (tt.want != "") || got != tt.want {
+				t.Errorf("got %q, %v; want %q", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummarizeLockfileLimitsNames(t *testing.T) {
+	var lock strings.Builder
+	for _, name := range strings.Split("abcdefghijkl", "") {
+		lock.WriteString("[[package]]\nname = \"" + name + "\"\nversion = \"1\"\n")
+	}
+	got, ok := summarizeLockfile("uv.lock", "", lock.String())
+	if !ok || !strings.HasSuffix(got, "  added: a 1, b 1, c 1, d 1, e 1, f 1, g 1, h 1, i 1, j 1 and 2 more\n") {
+		t.Errorf("got %q, %v", got, ok)
+	}
+}
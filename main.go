@@ -2,104 +2,938 @@ package main
 
 import (
 	"bytes"
+	"context"
 	_ "embed"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"path/filepath"
+	"os/signal"
+	pathpkg "path"
+	"runtime"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/pmezard/go-difflib/difflib"
+	flag "github.com/spf13/pflag"
 )
 
-const maxFileDiffSize = 8000     // Maximum characters for each file's diff
-const maxAddedFilePreview = 5000 // Maximum characters for previewing added files
-
 //go:embed systemPrompt.md
 var systemPrompt string
 
 type CommitMessageGenerator struct {
-	repo         *git.Repository
-	worktree     *git.Worktree
-	groqAPIKey   string
-	openAIAPIKey string
+	repo       *git.Repository
+	worktree   *git.Worktree
+	registry   *Registry
+	prompt     string
+	options    Options
+	attributes gitattributes.Matcher
+	ignore     gitignore.Matcher // .autogcmignore
+	exclusions exclusions
+	pathspec   pathspec
+	context    string      // Appended to the system prompt by -amend and merges
+	merge      *mergeState // In-progress merge, if any
+	reverting  *object.Commit
+	ticket     string // Referenced by the branch name
+	scopeRules []scopeRule
+	sendList   sendList  // -never-send and -send-only
+	trailers   []Trailer // Appended to every message
+	refinement string    // Appended to the system prompt by -refine
+	uncached   bool      // Neither read nor write the response cache, as for init's test
+
+	worktreeBlobs map[plumbing.Hash]string // Modified worktree files read for -all
+	blobMu        sync.Mutex               // go-git's object storage is not safe for concurrent reads
+	confirmed     map[string]bool          // Providers the user agreed to send the diff to
 }
 
-type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+// SamplingOptions are the generation parameters sent to every provider.
+// Negative temperature/top_p and zero max_tokens/seed leave the provider
+// default.
+type SamplingOptions struct {
+	Temperature float64
+	TopP        float64
+	MaxTokens   int
+	Seed        int
 }
 
-type OpenAIRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
+// deterministicSeed is sent with -deterministic to providers that support
+// reproducible sampling.
+const deterministicSeed = 1
+
+// Options holds the command line settings that tune generation.
+type Options struct {
+	Dir           string
+	All           bool
+	Amend         bool
+	Merge         bool
+	Squash        bool
+	Revert        string
+	Stdin         bool
+	Backend       string
+	Providers     []string
+	Models        map[string]string
+	Exclusions    ExclusionRules
+	Pathspecs     []string
+	Ticket        string
+	TicketPattern string
+	Project       bool
+	StyleHistory  int
+	StyleExamples int
+	StyleFilters  []string
+	Style         string
+	RetryAttempts int
+	Timeout       time.Duration
+	Proxy         string
+	CACert        string
+	Insecure      bool
+	transport     *http.Transport // Shared by all providers; see newTransport
+	MaxTime       time.Duration
+	Sampling      SamplingOptions
+	Deterministic bool
+	Template      string
+	Format        string
+	Explain       bool
+	NoCache       bool
+	LocalOnly     bool
+	LocalURL      string
+	Redact        bool
+	NeverSend     []string
+	SendOnly      []string
+	Confirm       bool
+	Yes           bool
+	Offline       bool // Fall back to offlineResult when no provider is reachable
+	Edit          bool
+	Copy          bool
+	Commit        bool
+	DryRun        bool
+	HookFile      string // Message file given to `autogcm hook`
+	Verbose       bool
+	Metrics       bool
+	AuditLog      string
+	Quiet         bool
+	Push          bool
+	SystemPrompt  string
+	ShowCost      bool
+	Proofread     bool
+	ProofreadLang string
+	Base          string
+	Head          string
+	Interactive   bool
+	SubmoduleLog  bool
+	Structured    bool
+	Conventional  bool
+	Lang          string
+	Candidates    int
+	Pick          bool
+	Refine        string
+	Oneline       bool
+	Detailed      bool
+	Signoff       bool
+	Trailers      []Trailer
+	SubjectLimit  int
+	WrapColumn    int
+	ScopeFrom     string
+	ScopeMap      []string
+	Gitmoji       bool
+	GitmojiCodes  bool
+	GitmojiMap    map[string]string
+	ASCII         bool
+	Check         bool
+	CheckOptions  CheckOptions
 }
 
-type OpenAIResponse struct {
-	Choices []struct {
-		Message struct {
-			Content string `json:"content"`
-		} `json:"message"`
-	} `json:"choices"`
+// Result is a generated commit message together with how it was produced.
+type Result struct {
+	Message    string
+	Partial    bool // Message was cut short by -max-time
+	Cached     bool // Message came from the response cache
+	Structured *StructuredMessage
+	// Alternatives are the other candidates asked for with -n.
+	Alternatives []Candidate
+	Provider     string
+	Model        string
+	Usage        Usage
+	Report       DiffReport
 }
 
 func main() {
-	generator, err := NewCommitMessageGenerator()
-	if err != nil {
+	var options Options
+	showVersion := flag.Bool("version", false, "print the version, commit, build date and Go version, and exit")
+	flag.StringVarP(&options.Dir, "C", "C", ".", "run as if autogcm was started in this directory")
+	flag.BoolVarP(&options.All, "a", "a", false, "include unstaged changes to tracked files, like git commit -a")
+	flag.BoolVar(&options.All, "all", false, "same as -a")
+	flag.BoolVar(&options.Amend, "amend", false, "describe HEAD together with the staged changes, for git commit --amend")
+	flag.BoolVar(&options.Merge, "merge", false, "write a merge commit message for the merge in progress (automatic when MERGE_HEAD exists)")
+	flag.BoolVar(&options.Stdin, "stdin", false, "read the diff from stdin (e.g. git diff --cached | autogcm -stdin) instead of the index")
+	flag.StringVar(&options.Backend, "backend", defaultBackend(), "how to collect the diff: go-git (built in) or git (run the git binary); also AUTOGCM_BACKEND")
+	flag.Var((*listFlag)(&options.Providers), "providers", "try only these providers, in this order (comma-separated; default local,groq,openai)")
+	flag.Var((*mapFlag)(&options.Models), "model", "use this model for a provider: PROVIDER=MODEL such as openai=gpt-4o (repeatable, comma-separated)")
+	flag.Var((*listFlag)(&options.Exclusions.ExcludeExtensions), "exclude-ext", "also exclude files with these extensions (repeatable, comma-separated)")
+	flag.Var((*listFlag)(&options.Exclusions.IncludeExtensions), "include-ext", "send files with these extensions even though they are excluded by default, e.g. .sum")
+	flag.Var((*listFlag)(&options.Exclusions.Patterns), "exclude", "exclude paths matching this gitignore-style pattern (repeatable)")
+	flag.Var((*sizeLimitFlag)(&options.Exclusions.SizeLimits), "exclude-larger", "exclude files larger than SIZE, optionally only those matching PATTERN: [PATTERN=]SIZE such as 'fixtures/**=10k' (repeatable)")
+	flag.StringVar(&options.Ticket, "ticket", defaultTicketMode(), "what to do with a ticket ID in the branch name (JIRA-123, #456, issue-456): footer (add Refs: or Closes:), subject (prefix the subject), context (only tell the model) or off; also AUTOGCM_TICKET")
+	flag.StringVar(&options.TicketPattern, "ticket-pattern", defaultTicketPattern(), "regular expression capturing the ticket in a branch name in its first group, e.g. '^(?:feature|fix)/([A-Z]+-[0-9]+|[0-9]+)-'; also AUTOGCM_TICKET_PATTERN")
+	flag.BoolVar(&options.Project, "project", false, "tell the model the repository name, module name (go.mod, package.json, ...) and primary language")
+	flag.IntVar(&options.StyleHistory, "style-history", 10, "look at this many recent commits to learn the repository's message style (0 disables)")
+	flag.IntVar(&options.StyleExamples, "style-examples", 3, "show this many of those commit messages to the model, spread over -style-history (0 disables)")
+	flag.Var((*listFlag)(&options.StyleFilters), "style-filter", "only learn the style from some commits: mine (by the current author), no-merges, no-bots (comma-separated)")
+	flag.StringVar(&options.Style, "style", defaultStyle(), "follow the conventions of this named profile: conventional, angular, kernel or one defined in .autogcm/styles.yaml; also AUTOGCM_STYLE")
+	flag.IntVar(&options.RetryAttempts, "retries", 3, "number of attempts per provider for transient HTTP failures")
+	flag.DurationVar(&options.Timeout, "timeout", 30*time.Second, "timeout for each provider request (0 disables)")
+	flag.StringVar(&options.Proxy, "proxy", "", "send provider requests through this proxy URL (http, https or socks5) instead of the one in HTTPS_PROXY/HTTP_PROXY")
+	flag.StringVar(&options.CACert, "ca-cert", "", "PEM file of extra CA certificates to trust, e.g. a TLS-intercepting corporate proxy's")
+	flag.BoolVar(&options.Insecure, "insecure", false, "do not verify the TLS certificates of providers and proxies (unsafe; prefer -ca-cert)")
+	flag.DurationVar(&options.MaxTime, "max-time", 0, "bound on the whole provider fallback chain; returns the best partial result when exceeded (0 disables)")
+	flag.Float64Var(&options.Sampling.Temperature, "temperature", -1, "sampling temperature (default: provider default)")
+	flag.Float64Var(&options.Sampling.TopP, "top-p", -1, "nucleus sampling top_p (default: provider default)")
+	flag.IntVar(&options.Sampling.MaxTokens, "max-tokens", 0, "maximum tokens in the generated message (default: provider default)")
+	flag.BoolVar(&options.Deterministic, "deterministic", false, "use temperature 0 and a fixed seed so the same staged changes give the same message")
+	flag.StringVar(&options.SystemPrompt, "system-prompt", defaultSystemPromptFile(), "use the system prompt in this file instead of the built-in one; also AUTOGCM_SYSTEM_PROMPT_FILE")
+	flag.StringVar(&options.Template, "template", "", "Go text/template applied to the generated message (e.g. '[{{.Repo}}] {{.Message}}')")
+	flag.StringVar(&options.Format, "format", formatText, "output format: text (the message) or json ({subject, body, type, scope, provider, model, tokens, truncated}) for scripts and editor plugins")
+	flag.BoolVar(&options.NoCache, "no-cache", false, "always ask the provider, instead of reusing the cached message when the prompt has not changed since an earlier run")
+	flag.Var((*listFlag)(&options.NeverSend), "never-send", "never send the content of paths matching this gitignore-style pattern, only their names, e.g. secrets/ or *.env (repeatable)")
+	flag.Var((*listFlag)(&options.SendOnly), "send-only", "send the content of only the paths matching this gitignore-style pattern and just the names of the rest (repeatable)")
+	flag.BoolVar(&options.LocalOnly, "local-only", false, "never send anything off this machine: use only providers on a loopback address and refuse every other connection")
+	flag.StringVar(&options.LocalURL, "local-url", "", "base `URL` of an OpenAI-compatible server such as Ollama (http://localhost:11434/v1) or LM Studio (http://localhost:1234/v1), used as the provider \"local\" with -model local=MODEL")
+	flag.BoolVar(&options.Redact, "redact", true, "replace likely secrets (private keys, AWS and other API tokens, credential values, high-entropy strings) in the diff with placeholders before sending it, with a warning")
+	flag.BoolVar(&options.Confirm, "confirm", false, "on a terminal, show which files and how many bytes go to which provider and ask before sending them")
+	flag.BoolVar(&options.Yes, "yes", false, "send without asking, even with -confirm")
+	flag.BoolVar(&options.Offline, "offline-fallback", false, "when no provider can be reached, write a simple message from the file list and diffstat instead of failing")
+	flag.BoolVar(&options.Explain, "explain", false, "also explain which files drove the subject and which changes were left out (to stderr, after the candidates of -n, or in the explanation field of -format json)")
+	flag.IntVarP(&options.Candidates, "n", "n", 1, "ask for this many alternative messages in one request and print them numbered")
+	flag.BoolVar(&options.Pick, "pick", true, "on a terminal, choose, edit or regenerate the message before it is printed (-pick=false prints it right away)")
+	flag.StringVar(&options.Refine, "refine", "", "revise the previous message as instructed (e.g. 'make it shorter and mention the migration') instead of starting over")
+	flag.BoolVarP(&options.Verbose, "v", "v", false, "log provider selection, diff statistics, token estimates, HTTP statuses and retries to stderr")
+	flag.BoolVar(&options.Verbose, "debug", false, "same as -v")
+	flag.BoolVar(&options.Metrics, "metrics", false, "record the provider, latency, token counts and outcome of every request (never any code) in a local stats file; see autogcm stats")
+	flag.StringVar(&options.AuditLog, "audit-log", "", "append every prompt sent to a provider and the answer, with timestamps, to this `file` for compliance review")
+	flag.BoolVar(&options.Quiet, "quiet", false, "print only the message and errors: no progress, notes or warnings on stderr")
+	flag.BoolVarP(&options.Quiet, "q", "q", false, "same as -quiet")
+	flag.BoolVar(&options.DryRun, "dry-run", false, "print the system prompt and diff that would be sent, after exclusions and truncation, without calling any provider")
+	flag.BoolVar(&options.Edit, "edit", false, "open the message in git's editor ($GIT_EDITOR, core.editor, $VISUAL, $EDITOR) and use what is saved; an emptied message aborts")
+	flag.BoolVar(&options.Copy, "copy", false, "also copy the final message to the system clipboard (pbcopy, clip, wl-copy, xclip or xsel)")
+	flag.BoolVar(&options.Commit, "commit", false, "run git commit with the message (honoring hooks and commit signing) instead of printing it; with -a or -amend, commits likewise")
+	flag.BoolVar(&options.Push, "push", false, "with -commit, then push to the branch's upstream, setting one up on the push remote for a new branch")
+	flag.BoolVar(&options.Oneline, "oneline", false, "write only a subject line")
+	flag.BoolVar(&options.Detailed, "detailed", false, "write a subject, a bulleted list of the changes and a paragraph on why")
+	flag.BoolVar(&options.Signoff, "signoff", false, "add a Signed-off-by trailer from user.name and user.email, like git commit -s")
+	flag.Var((*coAuthorFlag)(&options.Trailers), "co-author", "add a Co-authored-by trailer: 'Name <email>' (repeatable)")
+	flag.Var((*trailerFlag)(&options.Trailers), "trailer", "add a trailer: KEY=VALUE or 'KEY: VALUE', like git commit --trailer (repeatable)")
+	flag.StringVar(&options.Lang, "lang", defaultLang(), "write the message in this language (en, ja, de, ...) whatever the language of the diff; also AUTOGCM_LANG")
+	flag.IntVar(&options.SubjectLimit, "subject-limit", 0, "shorten subjects wider than this many columns, e.g. 50 or 72, keeping the full subject in the body (0 disables)")
+	flag.IntVar(&options.WrapColumn, "wrap", defaultWrapColumn, "hard-wrap body paragraphs at this column (0 disables)")
+	flag.BoolVar(&options.Proofread, "proofread", false, "run a spelling and grammar pass over the generated message")
+	flag.StringVar(&options.ProofreadLang, "proofread-lang", "ja", "language of the message for -proofread (en, ja, ...; defaults to -lang when set)")
+	flag.BoolVar(&options.ShowCost, "show-cost", false, "print token usage and estimated cost to stderr")
+	flag.StringVar(&options.Base, "base", "", "with -head, describe the changes from this tree-ish instead of the staged changes")
+	flag.StringVar(&options.Head, "head", "", "with -base, describe the changes up to this tree-ish; works on bare repositories")
+	flag.BoolVar(&options.Conventional, "conventional", false, "write a Conventional Commits message (type(scope): subject) and retry when the model gets the format wrong")
+	flag.StringVar(&options.ScopeFrom, "scope-from", scopeFromDir, "with -conventional or -structured, infer the scope from the top-level directory (dir) or the Go package (package) of the changed files")
+	flag.Var((*listFlag)(&options.ScopeMap), "scope-map", "use this scope for paths matching a gitignore-style pattern: PATTERN=SCOPE (repeatable, comma-separated; first match wins)")
+	flag.BoolVar(&options.Gitmoji, "gitmoji", false, "prefix the subject with the gitmoji of the change type (✨ feat, 🐛 fix, ...)")
+	flag.BoolVar(&options.GitmojiCodes, "gitmoji-shortcode", false, "with -gitmoji, use :shortcodes: such as :sparkles: instead of unicode emoji")
+	flag.Var((*mapFlag)(&options.GitmojiMap), "gitmoji-map", "with -gitmoji, use this emoji for a change type: TYPE=EMOJI (repeatable, comma-separated)")
+	flag.BoolVar(&options.ASCII, "ascii", false, "drop emoji and replace non-ASCII punctuation (“”, —, …, 。) with ASCII, for tooling that cannot handle unicode subjects; implies -gitmoji-shortcode")
+	flag.BoolVar(&options.Structured, "structured", false, "ask for a JSON {subject, body, type, scope} response instead of free text")
+	flag.BoolVar(&options.SubmoduleLog, "submodule-log", false, "include the log of submodule commits between the old and new pointers")
+	flag.BoolVarP(&options.Interactive, "i", "i", false, "choose which files and hunks are sent before calling the API")
+	flag.BoolVar(&options.Check, "check", false, "abort if staged files contain conflict markers, secrets or oversized files")
+	flag.BoolVar(&options.CheckOptions.ConflictMarkers, "check-conflicts", true, "with -check, reject conflict markers")
+	flag.BoolVar(&options.CheckOptions.Secrets, "check-secrets", true, "with -check, reject likely secrets")
+	flag.Int64Var(&options.CheckOptions.MaxFileSize, "check-max-size", 5*1024*1024, "with -check, reject staged files larger than this many bytes (0 disables)")
+	root := newRootCommand(&options, showVersion)
+	root.SetArgs(longFlags(root, os.Args[1:]))
+	if err := root.Execute(); err != nil {
+		// Invalid flags exit with exitError rather than the usual 2, which
+		// means there is nothing to describe.
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitError)
+	}
+}
+
+// setup loads the configuration into options and applies what the flags
+// imply before any command runs: verbosity, sampling, the transport and
+// the audit log. The context is canceled on interrupt.
+func setup(options *Options) (context.Context, context.CancelFunc) {
+	if err := loadConfig(flag.CommandLine, options.Dir); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	diff, err := generator.getStagedDiff()
+	if options.Verbose && options.Quiet {
+		fmt.Fprintln(os.Stderr, "Error: -v and -quiet cannot be combined")
+		os.Exit(exitError)
+	}
+	if options.Verbose {
+		debugLog.SetOutput(os.Stderr)
+	} else if options.Quiet {
+		notices = io.Discard
+	} else if isTerminal(os.Stderr) {
+		spin.enable(os.Stderr)
+	}
+
+	if templateStructured.MatchString(options.Template) {
+		options.Structured = true
+	}
+
+	if options.ASCII {
+		options.GitmojiCodes = true
+	}
+
+	if options.Deterministic {
+		options.Sampling.Temperature = 0
+		options.Sampling.Seed = deterministicSeed
+	}
+
+	if options.Lang != "" && !flagSet("proofread-lang") {
+		options.ProofreadLang = options.Lang
+	}
+
+	transport, err := newTransport(*options)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+	options.transport = transport
+	if options.Insecure {
+		fmt.Fprintln(notices, "Warning: -insecure: TLS certificates are not verified")
+	}
+	if err := newAuditLog(options.AuditLog).check(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return signal.NotifyContext(context.Background(), os.Interrupt)
+}
 
-	if diff == "" {
-		fmt.Fprintln(os.Stderr, "No staged changes found.")
+// generate writes the message for the changes options describe and
+// delivers it.
+func generate(ctx context.Context, options Options) {
+	if (options.Base == "") != (options.Head == "") {
+		fmt.Fprintln(os.Stderr, "Error: -base and -head must be given together")
+		os.Exit(1)
+	}
+
+	if options.All && options.treeMode() {
+		fmt.Fprintln(os.Stderr, "Error: -all cannot be combined with -base/-head, revert or squash")
+		os.Exit(1)
+	}
+
+	if options.Amend && options.treeMode() {
+		fmt.Fprintln(os.Stderr, "Error: -amend cannot be combined with -base/-head, revert or squash")
+		os.Exit(1)
+	}
+
+	if options.Merge && (options.treeMode() || options.Amend) {
+		fmt.Fprintln(os.Stderr, "Error: -merge cannot be combined with -base/-head, revert, squash or -amend")
+		os.Exit(1)
+	}
+
+	if options.Backend != backendGoGit && options.Backend != backendExec {
+		fmt.Fprintf(os.Stderr, "Error: unknown -backend %q (want %s or %s)\n", options.Backend, backendGoGit, backendExec)
+		os.Exit(1)
+	}
+
+	if options.ScopeFrom != scopeFromDir && options.ScopeFrom != scopeFromPackage {
+		fmt.Fprintf(os.Stderr, "Error: unknown -scope-from %q (want %s or %s)\n", options.ScopeFrom, scopeFromDir, scopeFromPackage)
+		os.Exit(1)
+	}
+
+	switch options.Ticket {
+	case ticketContext, ticketSubject, ticketFooter, ticketOff:
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown -ticket %q (want %s, %s, %s or %s)\n", options.Ticket, ticketContext, ticketSubject, ticketFooter, ticketOff)
+		os.Exit(1)
+	}
+
+	if options.Stdin && (options.treeMode() || options.All || options.Amend || options.Merge || options.Check) {
+		fmt.Fprintln(os.Stderr, "Error: -stdin cannot be combined with -base/-head, revert, squash, -all, -amend, -merge or -check")
+		os.Exit(1)
+	}
+
+	if options.Format != formatText && options.Format != formatJSON {
+		fmt.Fprintf(os.Stderr, "Error: unknown -format %q (want %s or %s)\n", options.Format, formatText, formatJSON)
 		os.Exit(1)
 	}
 
-	commitMessage, err := generator.lazyGenerateCommitMessage(diff)
+	if options.Oneline && options.Detailed {
+		fmt.Fprintln(os.Stderr, "Error: -oneline and -detailed cannot be combined")
+		os.Exit(1)
+	}
+
+	if options.Candidates < 1 {
+		fmt.Fprintf(os.Stderr, "Error: -n must be at least 1, got %d\n", options.Candidates)
+		os.Exit(1)
+	}
+
+	if options.Deterministic && (options.Candidates > 1 || flagSet("temperature")) {
+		fmt.Fprintln(os.Stderr, "Error: -deterministic cannot be combined with -n or -temperature")
+		os.Exit(1)
+	}
+
+	picking := options.Pick && isTerminal(os.Stdin) && isTerminal(os.Stderr)
+
+	if options.Commit && (options.Stdin || options.treeMode() || len(options.Pathspecs) > 0) {
+		fmt.Fprintln(os.Stderr, "Error: -commit commits the staged changes; it cannot be combined with -stdin, -base/-head, revert, squash or paths")
+		os.Exit(1)
+	}
+
+	if options.Confirm && !options.Yes && !options.DryRun && !(isTerminal(os.Stdin) && isTerminal(os.Stderr)) {
+		fmt.Fprintln(os.Stderr, "Error: -confirm needs a terminal to ask before sending the diff; pass -yes to send it anyway")
+		os.Exit(1)
+	}
+
+	if options.Push && !options.Commit {
+		fmt.Fprintln(os.Stderr, "Error: -push needs -commit")
+		os.Exit(1)
+	}
+
+	if options.Commit && options.Candidates > 1 && !picking {
+		fmt.Fprintln(os.Stderr, "Error: -commit with -n needs a terminal to pick the message")
+		os.Exit(1)
+	}
+
+	if options.Edit && options.Candidates > 1 && !picking && options.Format != formatJSON {
+		fmt.Fprintln(os.Stderr, "Error: -edit with -n needs a terminal to pick the message")
+		os.Exit(1)
+	}
+
+	if options.Check && options.treeMode() {
+		fmt.Fprintln(os.Stderr, "Error: -check cannot be combined with -base/-head, revert or squash")
+		os.Exit(1)
+	}
+
+	generator, err := NewCommitMessageGenerator(options)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitCode(err))
+	}
+
+	if options.Check {
+		failures, err := generator.runSafetyChecks(options.CheckOptions)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitGitError)
+		}
+		if len(failures) > 0 {
+			printCheckReport(os.Stderr, failures)
+			os.Exit(1)
+		}
+	}
+
+	spin.Status("collecting diff…")
+	var patches []FilePatch
+	if options.Stdin {
+		patches, err = generator.getDiffFrom(os.Stdin)
+	} else if generator.options.Backend == backendExec {
+		patches, err = generator.getGitDiff()
+	} else if options.treeMode() {
+		patches, err = generator.getTreeDiff(generator.options.Base, generator.options.Head)
+	} else {
+		patches, err = generator.getStagedDiff()
+	}
+	spin.Clear()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if options.Stdin {
+			os.Exit(exitError)
+		}
+		os.Exit(exitGitError)
+	}
+
+	collected := len(patches)
+	patches = generator.dropIgnored(patches)
+	patches = generator.sendList.withhold(patches)
+	patches = summarizeMoves(patches)
+	// Whatever the backend, identical changes give an identical prompt, so
+	// the response cache hits and the message does not vary between runs.
+	sort.SliceStable(patches, func(i, j int) bool { return patches[i].Path < patches[j].Path })
+	if options.Redact {
+		patches = redactSecrets(patches, notices)
+	}
+	if options.Verbose {
+		var added, removed int
+		for _, p := range patches {
+			a, r := diffstat(p.Patch)
+			added, removed = added+a, removed+r
+		}
+		debugf("diff: %d files collected, %d after %s, +%d -%d lines", collected, len(patches), ignoreFile, added, removed)
+	}
+
+	if generator.merge != nil {
+		// The merged commits are described by their log; only the conflict
+		// resolutions need their diff.
+		patches = conflictPatches(patches, generator.merge)
+	}
+
+	switch {
+	case len(patches) > 0:
+	case generator.merge != nil:
+		// Nothing conflicted; the log of merged commits is enough.
+	case collected > 0:
+		fmt.Fprintf(os.Stderr, "All changed files are listed in %s.\n", ignoreFile)
+		os.Exit(exitNoChanges)
+	case options.Stdin:
+		fmt.Fprintln(os.Stderr, "No diff on stdin.")
+		os.Exit(exitNoChanges)
+	case options.treeMode():
+		fmt.Fprintf(os.Stderr, "No changes between %s and %s.\n", generator.options.Base, generator.options.Head)
+		os.Exit(exitNoChanges)
+	case len(options.Pathspecs) > 0:
+		fmt.Fprintf(os.Stderr, "No changes found matching %s.\n", strings.Join(options.Pathspecs, " "))
+		os.Exit(exitNoChanges)
+	case options.All:
+		fmt.Fprintln(os.Stderr, "No changes to tracked files found.")
+		os.Exit(exitNoChanges)
+	default:
+		fmt.Fprintln(os.Stderr, "No staged changes found.")
+		os.Exit(exitNoChanges)
+	}
+
+	if options.Interactive && len(patches) > 0 {
+		patches, err = generator.selectPatches(patches, os.Stdin, os.Stderr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(patches) == 0 {
+			fmt.Fprintln(os.Stderr, "Nothing selected.")
+			os.Exit(1)
+		}
+	}
+
+	var meta RepoMetadata
+	if options.Template != "" || slices.ContainsFunc(options.Trailers, templateTrailer) {
+		meta, err = generator.getRepoMetadata(patches)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitGitError)
+		}
+	}
+
+	var result Result
+	var messages []string
+	if options.Refine != "" {
+		previous := generator.loadLastMessage()
+		if previous == "" {
+			fmt.Fprintln(os.Stderr, "Error: no previous message to refine; run autogcm without -refine first")
+			os.Exit(1)
+		}
+		if options.DryRun {
+			generator.refinement = refineContext(previous, options.Refine)
+		} else {
+			result, messages, err = generator.refineMessages(ctx, patches, meta, previous, options.Refine)
+		}
+	} else if !options.DryRun {
+		result, messages, err = generator.generateMessages(ctx, patches, meta)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error generating commit message: %v\n", err)
+		if errors.Is(err, errAborted) {
+			os.Exit(exitError)
+		}
+		os.Exit(exitProvidersFailed)
+	}
+
+	if options.DryRun {
+		if err := generator.printDryRun(os.Stdout, patches); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// deliver lets the user edit the final message with -edit, commits it
+	// with -commit, pushes it with -push, prints it and copies it with
+	// -copy, or in hook mode writes it to the message file.
+	deliver := func(message string, alternatives []string) {
+		if options.Edit {
+			edited, err := generator.editMessage(message)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			message = edited
+		}
+		var explanation string
+		if !options.Quiet || options.Format == formatJSON {
+			// Under -quiet only the message is printed, so the
+			// explanation would go nowhere.
+			explanation = generator.explanation(ctx, result, message, patches)
+		}
+		if options.HookFile != "" {
+			if err := writeHookMessage(options.HookFile, message); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+		if options.Commit {
+			if err := generator.commit(message); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitGitError)
+			}
+		}
+		if options.Push {
+			if err := generator.push(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitGitError)
+			}
+		}
+		printResult(options, result, message, alternatives, explanation)
+		if options.Copy {
+			if err := copyToClipboard(message); err != nil {
+				fmt.Fprintf(notices, "Warning: could not copy the message to the clipboard: %v\n", err)
+			}
+		}
+	}
+
+	if picking {
+		regenerate := func(previous string, instruction string) ([]string, error) {
+			// The cache would only hand back the same answer.
+			generator.options.NoCache = true
+			var messages []string
+			if instruction == "" {
+				result, messages, err = generator.generateMessages(ctx, patches, meta)
+			} else {
+				result, messages, err = generator.refineMessages(ctx, patches, meta, previous, instruction)
+			}
+			return messages, err
+		}
+		message, err := pickMessage(messages, regenerate, os.Stdin, os.Stderr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		generator.rememberMessage(message)
+		deliver(message, nil)
+		return
+	}
+
+	generator.rememberMessage(messages[0])
+
+	if len(messages) < options.Candidates {
+		fmt.Fprintf(notices, "Note: only %d of %d candidates were usable\n", len(messages), options.Candidates)
+	}
+	if len(messages) == 1 || options.Format == formatJSON {
+		deliver(messages[0], messages[1:])
+		return
+	}
+	explanation := generator.explanation(ctx, result, messages[0], patches)
+	printCandidates(os.Stdout, messages, explanation)
+}
+
+// explanation returns the rationale for message when -explain is given.
+func (g *CommitMessageGenerator) explanation(ctx context.Context, result Result, message string, patches []FilePatch) string {
+	if !g.options.Explain {
+		return ""
+	}
+
+	return g.explain(ctx, result, message, patches)
+}
+
+// printResult writes the final message to stdout in the -format chosen.
+// With -commit, git has already shown it and plain text is not repeated.
+func printResult(options Options, result Result, message string, alternatives []string, explanation string) {
+	if options.Format != formatJSON {
+		if !options.Commit {
+			fmt.Fprint(os.Stdout, message)
+		}
+		return
+	}
+	var structured *StructuredMessage
+	if result.Structured != nil && strings.HasPrefix(message, strings.TrimSpace(result.Structured.Subject)) {
+		structured = result.Structured
+	}
+	if err := printJSON(os.Stdout, result, message, structured, alternatives, explanation); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+}
+
+// generateMessages asks the providers for a message and finishes every
+// candidate, reporting a degraded diff and the cost to stderr.
+func (g *CommitMessageGenerator) generateMessages(ctx context.Context, patches []FilePatch, meta RepoMetadata) (Result, []string, error) {
+	result, err := g.lazyGenerateCommitMessage(ctx, patches)
+	if err != nil && g.options.Offline && isUnreachable(err) {
+		fmt.Fprintf(notices, "Warning: no provider could be reached (%v); writing the message offline\n", err)
+		result, err = g.offlineResult(patches), nil
+	}
+	if err != nil {
+		return result, nil, err
+	}
+
+	candidates := append([]Candidate{{Message: result.Message, Structured: result.Structured}}, result.Alternatives...)
+	messages := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		messages[i], err = g.finishMessage(ctx, result, candidate, meta)
+		if err != nil {
+			return result, nil, err
+		}
+	}
 
-	fmt.Fprint(os.Stdout, commitMessage)
+	if result.Report.Degraded() {
+		fmt.Fprintf(notices, "Note: the message may be incomplete; %s\n", result.Report)
+	}
+
+	if g.options.ShowCost {
+		printCost(os.Stderr, result)
+	}
+	return result, messages, nil
 }
 
-func NewCommitMessageGenerator() (*CommitMessageGenerator, error) {
-	groqAPIKey := os.Getenv("GROQ_API_KEY")
-	if groqAPIKey == "" {
-		return nil, fmt.Errorf("GROQ_API_KEY environment variable is not set")
+// finishMessage applies the local post-processing to a generated message:
+// the revert reference, ticket, gitmoji, proofreading, layout, ASCII
+// folding, trailers and template.
+func (g *CommitMessageGenerator) finishMessage(ctx context.Context, result Result, candidate Candidate, meta RepoMetadata) (string, error) {
+	options := g.options
+	message := candidate.Message
+	if g.reverting != nil {
+		message = ensureRevertReference(message, g.reverting.Hash)
+	}
+	message = injectTicket(message, g.ticket, options.Ticket)
+	if options.Gitmoji {
+		message = options.applyGitmoji(message, candidate.Structured)
+	}
+
+	if options.Proofread {
+		result.Message = message
+		message = g.proofread(ctx, result, options.ProofreadLang)
+	}
+
+	message = formatMessage(message, options.SubjectLimit, options.WrapColumn)
+	if options.Oneline {
+		message = subjectLine(message)
+	}
+	if options.ASCII {
+		message = asciiOnly(message)
+	}
+	trailers, err := expandTrailers(g.trailers, meta)
+	if err != nil {
+		return "", err
+	}
+	message = appendTrailers(message, trailers)
+
+	if options.Template != "" {
+		return applyTemplate(options.Template, message, candidate.Structured, meta)
+	}
+	return message, nil
+}
+
+// treeMode reports whether the diff is taken between two revisions rather
+// than from the index.
+func (o Options) treeMode() bool {
+	return o.Base != "" && o.Head != ""
+}
+
+// openRepository opens the repository containing dir, searching parent
+// directories for .git like git itself does. Linked worktrees, whose .git
+// is a file, share objects and refs through the main repository's
+// commondir.
+func openRepository(dir string) (*git.Repository, error) {
+	return git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{DetectDotGit: true, EnableDotGitCommonDir: true})
+}
+
+func NewCommitMessageGenerator(options Options) (*CommitMessageGenerator, error) {
+	prompt, _, err := loadSystemPrompt(options.SystemPrompt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkProviders(options); err != nil {
+		return nil, err
+	}
+	registry := newRegistry(options)
+	// -dry-run still needs a provider to fit the diff to.
+	if options.LocalOnly && (len(registry.Available()) == 0 && !options.DryRun || registry.providers == nil) {
+		var cloud []string
+		for _, p := range newRegistry(Options{Providers: options.Providers, Models: options.Models, LocalURL: options.LocalURL}).Available() {
+			cloud = append(cloud, p.Name())
+		}
+		if len(cloud) > 0 {
+			return nil, fmt.Errorf("%w: -local-only allows only providers on this machine, but the configured ones (%s) are not on this machine", errNoProvider, strings.Join(cloud, ", "))
+		}
+		return nil, fmt.Errorf("%w: -local-only allows only providers on this machine; set -local-url to a local server such as http://localhost:11434/v1 and -model local=MODEL", errNoProvider)
+	}
+	if len(registry.Available()) == 0 && !options.DryRun {
+		return nil, fmt.Errorf("%w: set GROQ_API_KEY or OPENAI_API_KEY (or AUTOGCM_<KEY>_CMD), run `autogcm auth set <provider>`, or set -local-url and -model local=MODEL for a local server", errNoProvider)
+	}
+
+	// A diff read from stdin needs no repository; one is still used for
+	// .gitattributes and template metadata when present.
+	var worktree *git.Worktree
+	repo, err := openRepository(options.Dir)
+	switch {
+	case err == nil:
+		worktree, err = repo.Worktree()
+		if err != nil && !(errors.Is(err, git.ErrIsBareRepository) && (options.treeMode() || options.Stdin)) {
+			return nil, gitError{fmt.Errorf("getting worktree: %w", err)}
+		}
+	case options.Stdin && errors.Is(err, git.ErrRepositoryNotExists):
+		repo = nil
+	default:
+		return nil, gitError{fmt.Errorf("opening repository: %w", err)}
+	}
+
+	attributes, err := loadAttributes(worktree)
+	if err != nil {
+		return nil, err
+	}
+
+	ignore, err := loadIgnore(worktree)
+	if err != nil {
+		return nil, err
+	}
+
+	var root string
+	if worktree != nil {
+		root = worktree.Filesystem.Root()
 	}
-	openAIAPIKey := os.Getenv("OPENAI_API_KEY")
-	if openAIAPIKey == "" {
-		return nil, fmt.Errorf("OPENAI_API_KEY environment variable is not set")
+	spec, err := newPathspec(options.Dir, root, options.Pathspecs)
+	if err != nil {
+		return nil, err
+	}
+
+	scopeRules, err := parseScopeRules(options.ScopeMap)
+	if err != nil {
+		return nil, err
 	}
 
-	repo, err := git.PlainOpen(".")
+	ticketPattern, err := parseTicketPattern(options.TicketPattern)
 	if err != nil {
-		return nil, fmt.Errorf("opening repository: %w", err)
+		return nil, err
+	}
+
+	if err := checkStyleFilters(options.StyleFilters); err != nil {
+		return nil, err
+	}
+
+	g := &CommitMessageGenerator{
+		repo:       repo,
+		worktree:   worktree,
+		registry:   registry,
+		prompt:     prompt,
+		options:    options,
+		attributes: attributes,
+		ignore:     ignore,
+		exclusions: newExclusions(options.Exclusions),
+		pathspec:   spec,
+		scopeRules: scopeRules,
+		sendList:   newSendList(options.NeverSend, options.SendOnly),
+	}
+
+	// go-git cannot read a sparse index; git can.
+	if options.Backend == backendGoGit && !options.treeMode() && !options.Stdin && g.sparseIndex() {
+		g.options.Backend = backendExec
+	}
+
+	if options.Squash {
+		if g.context, err = g.squashContext(); err != nil {
+			return nil, gitError{err}
+		}
+	}
+
+	if options.Amend {
+		amending, err := g.headMessage()
+		if err != nil {
+			return nil, gitError{err}
+		}
+		g.context = amendPrompt + amending + "\n"
+	}
+
+	if !options.treeMode() && !options.Amend && !options.Stdin {
+		if g.merge, err = g.readMergeState(); err != nil {
+			return nil, gitError{err}
+		}
+		if options.Merge && g.merge == nil {
+			return nil, fmt.Errorf("no merge in progress (MERGE_HEAD not found)")
+		}
+		if g.merge != nil {
+			if g.context, err = g.mergeContext(g.merge); err != nil {
+				return nil, gitError{err}
+			}
+		}
+	}
+
+	if options.Revert != "" {
+		g.reverting, err = g.resolveCommit(options.Revert)
+		if err == nil && g.reverting.NumParents() == 0 {
+			// options.Head, the parent, does not exist.
+			return nil, fmt.Errorf("%s is the root commit; there is no parent to revert to", options.Revert)
+		}
+	} else if !options.treeMode() && !options.Amend && !options.Stdin && g.merge == nil {
+		g.reverting, err = g.revertTarget()
+	}
+	if err != nil {
+		return nil, gitError{err}
+	}
+	if g.reverting != nil {
+		g.context = g.revertContext(g.reverting)
+	}
+
+	// A range being described need not be on the current branch.
+	if !options.treeMode() {
+		branch, err := g.currentBranch()
+		if err != nil {
+			return nil, gitError{err}
+		}
+		if branch != "" {
+			if options.Ticket != ticketOff {
+				g.ticket = ticketFromBranch(branch, ticketPattern)
+			}
+			g.context += g.branchContext(branch)
+		}
+	}
+
+	g.trailers = options.Trailers
+	if options.Signoff {
+		signoff, err := g.signoffTrailer()
+		if err != nil {
+			return nil, gitError{err}
+		}
+		g.trailers = append(g.trailers, signoff)
 	}
 
-	worktree, err := repo.Worktree()
+	repoPrompt, err := g.repoPromptContext()
 	if err != nil {
-		return nil, fmt.Errorf("getting worktree: %w", err)
+		return nil, err
+	}
+	g.prompt += repoPrompt
+
+	if options.Style != "" {
+		profile, err := g.loadStyleProfile(options.Style)
+		if err != nil {
+			return nil, err
+		}
+		g.prompt += g.options.applyStyleProfile(options.Style, profile)
+	}
+
+	// A revert follows the style of earlier reverts instead.
+	if g.reverting == nil {
+		g.context += g.styleContext()
+	}
+
+	if options.Project {
+		project, err := g.projectContext()
+		if err != nil {
+			return nil, err
+		}
+		g.context += project
 	}
 
-	return &CommitMessageGenerator{
-		repo:         repo,
-		worktree:     worktree,
-		groqAPIKey:   groqAPIKey,
-		openAIAPIKey: openAIAPIKey,
-	}, nil
+	return g, nil
 }
 
 var excludedExtensions = map[string]bool{
@@ -123,120 +957,204 @@ var excludedExtensions = map[string]bool{
 	".sum":   true,
 }
 
-func (g *CommitMessageGenerator) getStagedDiff() (string, error) {
-	status, err := g.worktree.Status()
+// DiffReport records which files were left out of, or shortened in, the
+// prompt so the user knows the message may be incomplete.
+type DiffReport struct {
+	Excluded  []string `json:"excluded,omitempty"`
+	Truncated []string `json:"truncated,omitempty"`
+	Omitted   []string `json:"omitted,omitempty"` // Only listed in a diffstat
+}
+
+// Degraded reports whether any file was excluded, truncated or omitted.
+func (r DiffReport) Degraded() bool {
+	return len(r.Excluded) > 0 || len(r.Truncated) > 0 || len(r.Omitted) > 0
+}
+
+func (r DiffReport) String() string {
+	var parts []string
+	if len(r.Truncated) > 0 {
+		parts = append(parts, fmt.Sprintf("%d file(s) truncated: %s", len(r.Truncated), strings.Join(r.Truncated, ", ")))
+	}
+	if len(r.Omitted) > 0 {
+		parts = append(parts, fmt.Sprintf("%d file(s) only listed: %s", len(r.Omitted), strings.Join(r.Omitted, ", ")))
+	}
+	if len(r.Excluded) > 0 {
+		parts = append(parts, fmt.Sprintf("%d excluded: %s", len(r.Excluded), strings.Join(r.Excluded, ", ")))
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (g *CommitMessageGenerator) getStagedDiff() ([]FilePatch, error) {
+	changes, err := g.stagedChanges()
 	if err != nil {
-		return "", fmt.Errorf("getting status: %w", err)
+		return nil, err
 	}
+	return g.renderChanges(changes)
+}
 
-	var diff bytes.Buffer
+// renderChanges renders the patches of changes, keeping their order.
+// Diffing dominates on large changes, so files are diffed by a pool of
+// workers.
+func (g *CommitMessageGenerator) renderChanges(changes []fileChange) ([]FilePatch, error) {
+	patches := make([]FilePatch, len(changes))
+	errs := make([]error, len(changes))
+	jobs := make(chan int)
+	var done atomic.Int32
+	var wg sync.WaitGroup
+	for range min(runtime.GOMAXPROCS(0), len(changes)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				patches[i], errs[i] = g.renderChange(changes[i])
+				spin.Status("collecting diff… %d/%d files", done.Add(1), len(changes))
+			}
+		}()
+	}
+	for i := range changes {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("generating patch for %s: %w", changes[i].Path, err)
+		}
+	}
+	return patches, nil
+}
 
-	for filePath, fileStatus := range status {
-		if g.shouldExcludeFile(filePath) {
-			diff.WriteString(fmt.Sprintf("Excluded file: %s (binary or large data file)\n", filePath))
-			continue
+// renderChange renders a change from the blobs it records, so unstaged
+// edits in the worktree never leak in. Files excluded by their path are
+// not read at all, except lockfiles, which are summarized instead.
+func (g *CommitMessageGenerator) renderChange(change fileChange) (FilePatch, error) {
+	if change.OldMode == filemode.Submodule || change.NewMode == filemode.Submodule {
+		var log []string
+		if g.options.SubmoduleLog {
+			log = g.submoduleLog(change.Path, change.OldHash, change.NewHash)
 		}
+		return FilePatch{
+			Path:  change.Path,
+			Patch: formatSubmodulePatch(change.Path, change.OldHash, change.NewHash, log),
+		}, nil
+	}
+
+	oldPath := change.Path
+	if change.OldPath != "" {
+		oldPath = change.OldPath
+	}
+	if _, lockfile := lockfileParsers[pathpkg.Base(change.Path)]; !lockfile && (g.excludedPath(oldPath) || g.excludedPath(change.Path)) {
+		return excludedPatch(change.Path), nil
+	}
 
-		var patch string
-		var err error
+	var oldContent, newContent string
+	var err error
 
-		switch fileStatus.Staging {
-		case git.Added:
-			patch, err = g.getAddedPatch(filePath, maxAddedFilePreview)
-		case git.Modified:
-			patch, err = g.getModifiedPatch(filePath)
-		case git.Deleted:
-			patch, err = g.getDeletedPatch(filePath)
-		default:
-			continue
+	if change.Action != git.Added {
+		if oldContent, err = g.getBlobContent(change.OldHash); err != nil {
+			return FilePatch{}, err
+		}
+	}
+	if change.Action != git.Deleted {
+		if newContent, err = g.getBlobContent(change.NewHash); err != nil {
+			return FilePatch{}, err
 		}
+	}
+
+	oldContent, oldEncoding := toUTF8(oldContent)
+	newContent, newEncoding := toUTF8(newContent)
+
+	if change.Action != git.Renamed && (change.OldMode == filemode.Symlink || change.NewMode == filemode.Symlink) {
+		return FilePatch{
+			Path:  change.Path,
+			Patch: formatSymlinkPatch(change.Path, oldContent, newContent, change.OldMode, change.NewMode),
+		}, nil
+	}
+
+	if summary, ok := summarizeLockfile(change.Path, oldContent, newContent); ok {
+		return FilePatch{Path: change.Path, Patch: summary}, nil
+	}
 
+	if g.shouldExcludeFile(oldPath, oldContent) || g.shouldExcludeFile(change.Path, newContent) {
+		return excludedPatch(change.Path), nil
+	}
+
+	if g.isGenerated(change.Path, oldContent, newContent) {
+		return generatedPatch(change.Path, oldContent, newContent), nil
+	}
+
+	var patch string
+	switch change.Action {
+	case git.Renamed:
+		patch, err = formatRenamePatch(change.OldPath, change.Path, oldContent, newContent, change.OldMode, change.NewMode)
 		if err != nil {
-			return "", fmt.Errorf("generating patch for %s: %w", filePath, err)
+			return FilePatch{}, err
 		}
-
-		// Truncate the patch if it exceeds the max size (except for added files)
-		if fileStatus.Staging != git.Added && len(patch) > maxFileDiffSize {
-			patch, truncated := g.truncatePatch(patch, maxFileDiffSize)
-			if truncated {
-				patch += fmt.Sprintf("\n... (truncated, total %d characters) ...\n", len(patch))
-			}
+	case git.Added:
+		patch = formatAddedPatch(change.Path, newContent, change.NewMode)
+	case git.Deleted:
+		patch = formatDeletedPatch(change.Path, oldContent, change.OldMode)
+	default:
+		patch, err = formatModifiedPatch(change.Path, oldContent, newContent, change.OldMode, change.NewMode)
+		if err != nil {
+			return FilePatch{}, err
 		}
-
-		diff.WriteString(patch)
 	}
 
-	return diff.String(), nil
+	patch = withGoSummary(change.Path, patch, oldContent, newContent)
+
+	return FilePatch{Path: change.Path, Patch: noteEncoding(patch, oldEncoding, newEncoding)}, nil
 }
 
-func (g *CommitMessageGenerator) shouldExcludeFile(filePath string) bool {
-	ext := strings.ToLower(filepath.Ext(filePath))
-	if excludedExtensions[ext] {
-		return true
+func excludedPatch(filePath string) FilePatch {
+	return FilePatch{
+		Path:     filePath,
+		Patch:    fmt.Sprintf("Excluded file: %s (binary or large data file)\n", filePath),
+		Excluded: true,
 	}
+}
 
-	// Check if the file is likely to be a binary file
-	content, err := g.getUnstagedFileContent(filePath)
-	if err != nil {
-		// If we can't read the file, assume it's binary
+func (g *CommitMessageGenerator) shouldExcludeFile(filePath string, content string) bool {
+	if g.excludedPath(filePath) || g.exclusions.exceedsSizeLimit(filePath, len(content)) {
 		return true
 	}
 
-	// Check for null bytes, which are common in binary files
-	if bytes.IndexByte([]byte(content), 0) != -1 {
-		return true
-	}
+	// Check if the file is likely to be a binary file
+	return isBinaryContent(content)
+}
 
-	return false
+// excludedPath applies the exclusions that depend only on the path: the
+// extension list, -exclude patterns and .gitattributes.
+func (g *CommitMessageGenerator) excludedPath(filePath string) bool {
+	return g.exclusions.excludesPath(filePath) || g.diffDisabled(filePath)
 }
 
-func (g *CommitMessageGenerator) getAddedPatch(filePath string, maxPreview int) (string, error) {
-	content, err := g.getUnstagedFileContent(filePath)
-	if err != nil {
-		return "", fmt.Errorf("getting file content: %w", err)
-	}
+// isBinaryContent checks for null bytes, which are common in binary files.
+func isBinaryContent(content string) bool {
+	return strings.IndexByte(content, 0) != -1
+}
 
+func formatAddedPatch(filePath string, content string, mode filemode.FileMode) string {
 	var diff bytes.Buffer
 	diff.WriteString(fmt.Sprintf("diff --git a/%s b/%s\n", filePath, filePath))
-	diff.WriteString("new file mode 100644\n")
+	diff.WriteString(fmt.Sprintf("new file mode %s\n", modeString(mode)))
 	diff.WriteString("--- /dev/null\n")
 	diff.WriteString(fmt.Sprintf("+++ b/%s\n", filePath))
 
-	if len(content) > maxPreview {
-		preview := content[:maxPreview]
-		lineCount := strings.Count(content, "\n") + 1
-		diff.WriteString(fmt.Sprintf("@@ -0,0 +1,%d @@ (preview)\n", lineCount))
-		for _, line := range strings.Split(preview, "\n") {
-			diff.WriteString("+" + line + "\n")
-		}
-		diff.WriteString(fmt.Sprintf("\n... (file truncated, total %d characters) ...\n", len(content)))
-	} else {
-		lineCount := strings.Count(content, "\n") + 1
-		diff.WriteString(fmt.Sprintf("@@ -0,0 +1,%d @@\n", lineCount))
-		for _, line := range strings.Split(content, "\n") {
-			diff.WriteString("+" + line + "\n")
-		}
+	lineCount := strings.Count(content, "\n") + 1
+	diff.WriteString(fmt.Sprintf("@@ -0,0 +1,%d @@\n", lineCount))
+	for _, line := range strings.Split(content, "\n") {
+		diff.WriteString("+" + line + "\n")
 	}
 
-	return diff.String(), nil
+	return diff.String()
 }
 
-func (g *CommitMessageGenerator) getModifiedPatch(filePath string) (string, error) {
-	// Get the staged version of the file
-	stagedContent, err := g.getStagedFileContent(filePath)
-	if err != nil {
-		return "", fmt.Errorf("getting staged content: %w", err)
-	}
-
-	// Get the unstaged version of the file
-	unstagedContent, err := g.getUnstagedFileContent(filePath)
-	if err != nil {
-		return "", fmt.Errorf("getting unstaged content: %w", err)
-	}
-
+func formatModifiedPatch(filePath string, oldContent string, newContent string, oldMode filemode.FileMode, newMode filemode.FileMode) (string, error) {
 	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
-		A:        difflib.SplitLines(stagedContent),
-		B:        difflib.SplitLines(unstagedContent),
+		A:        difflib.SplitLines(oldContent),
+		B:        difflib.SplitLines(newContent),
 		FromFile: "a/" + filePath,
 		ToFile:   "b/" + filePath,
 		Context:  3,
@@ -245,46 +1163,62 @@ func (g *CommitMessageGenerator) getModifiedPatch(filePath string) (string, erro
 		return "", fmt.Errorf("generating diff: %w", err)
 	}
 
-	return fmt.Sprintf("diff --git a/%s b/%s\n%s", filePath, filePath, diff), nil
+	return fmt.Sprintf("diff --git a/%s b/%s\n%s%s", filePath, filePath, formatModeChange(oldMode, newMode), diff), nil
 }
 
-func (g *CommitMessageGenerator) truncatePatch(patch string, maxSize int) (string, bool) {
-	if len(patch) <= maxSize {
-		return patch, false
+// formatModeChange returns git's "old mode"/"new mode" header lines when a
+// file's permissions changed, so that e.g. making a script executable is
+// visible even without content changes.
+func formatModeChange(oldMode filemode.FileMode, newMode filemode.FileMode) string {
+	if oldMode == newMode || oldMode == 0 || newMode == 0 {
+		return ""
 	}
+	return fmt.Sprintf("old mode %s\nnew mode %s\n", modeString(oldMode), modeString(newMode))
+}
 
-	lines := strings.Split(patch, "\n")
-	var truncated bytes.Buffer
-	var currentSize int
-
-	// Always include the file name and diff header
-	for i, line := range lines {
-		if i < 2 || strings.HasPrefix(line, "@@") {
-			truncated.WriteString(line + "\n")
-			currentSize += len(line) + 1
-			continue
-		}
-
-		if currentSize+len(line)+1 > maxSize {
-			break
-		}
+// modeString formats a mode as the six octal digits git prints.
+func modeString(mode filemode.FileMode) string {
+	return fmt.Sprintf("%06o", uint32(mode))
+}
 
-		truncated.WriteString(line + "\n")
-		currentSize += len(line) + 1
+// formatRenamePatch renders a rename with git's extended headers, followed
+// by the content changes if the file was also edited.
+func formatRenamePatch(oldPath string, newPath string, oldContent string, newContent string, oldMode filemode.FileMode, newMode filemode.FileMode) (string, error) {
+	var diff bytes.Buffer
+	diff.WriteString(fmt.Sprintf("diff --git a/%s b/%s\n", oldPath, newPath))
+	diff.WriteString(formatModeChange(oldMode, newMode))
+	if oldContent == newContent {
+		diff.WriteString("similarity index 100%\n")
+	} else {
+		ratio := difflib.NewMatcher(difflib.SplitLines(oldContent), difflib.SplitLines(newContent)).Ratio()
+		diff.WriteString(fmt.Sprintf("similarity index %d%%\n", int(ratio*100)))
 	}
+	diff.WriteString(fmt.Sprintf("rename from %s\n", oldPath))
+	diff.WriteString(fmt.Sprintf("rename to %s\n", newPath))
 
-	return truncated.String(), true
-}
+	if oldContent == newContent {
+		return diff.String(), nil
+	}
 
-func (g *CommitMessageGenerator) getDeletedPatch(filePath string) (string, error) {
-	content, err := g.getStagedFileContent(filePath)
+	changes, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(oldContent),
+		B:        difflib.SplitLines(newContent),
+		FromFile: "a/" + oldPath,
+		ToFile:   "b/" + newPath,
+		Context:  3,
+	})
 	if err != nil {
-		return "", fmt.Errorf("getting file content: %w", err)
+		return "", fmt.Errorf("generating diff: %w", err)
 	}
+	diff.WriteString(changes)
 
+	return diff.String(), nil
+}
+
+func formatDeletedPatch(filePath string, content string, mode filemode.FileMode) string {
 	var diff bytes.Buffer
 	diff.WriteString(fmt.Sprintf("diff --git a/%s b/%s\n", filePath, filePath))
-	diff.WriteString("deleted file mode 100644\n")
+	diff.WriteString(fmt.Sprintf("deleted file mode %s\n", modeString(mode)))
 	diff.WriteString("--- a/" + filePath + "\n")
 	diff.WriteString("+++ /dev/null\n")
 
@@ -294,117 +1228,228 @@ func (g *CommitMessageGenerator) getDeletedPatch(filePath string) (string, error
 		diff.WriteString("-" + line + "\n")
 	}
 
-	return diff.String(), nil
+	return diff.String()
 }
 
-func (g *CommitMessageGenerator) getStagedFileContent(filePath string) (string, error) {
-	head, err := g.repo.Head()
-	if err != nil {
-		return "", fmt.Errorf("getting HEAD: %w", err)
+var errMaxTime = errors.New("-max-time exceeded")
+
+func (g *CommitMessageGenerator) lazyGenerateCommitMessage(ctx context.Context, patches []FilePatch) (Result, error) {
+	if g.options.MaxTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, g.options.MaxTime, errMaxTime)
+		defer cancel()
 	}
 
-	commit, err := g.repo.CommitObject(head.Hash())
-	if err != nil {
-		return "", fmt.Errorf("getting commit object: %w", err)
+	providers := g.registry.Available()
+	if g.options.Verbose {
+		var names []string
+		for _, p := range providers {
+			names = append(names, fmt.Sprintf("%s (%s)", p.Name(), p.Model()))
+		}
+		debugf("providers in fallback order: %s", strings.Join(names, ", "))
 	}
 
-	tree, err := commit.Tree()
-	if err != nil {
-		return "", fmt.Errorf("getting tree: %w", err)
+	var result, best Result
+	var err error
+	for i, p := range providers {
+		debugf("asking %s", p.Name())
+		spin.Status("asking %s…", p.Model())
+		start := time.Now()
+		result, err = g.generateForModel(ctx, p, patches)
+		g.recordUsage(p, result, err, time.Since(start))
+		spin.Clear()
+		if err == nil {
+			debugf("%s: %d prompt + %d completion tokens", p.Name(), result.Usage.PromptTokens, result.Usage.CompletionTokens)
+			return result, nil
+		}
+		debugf("%s failed: %v", p.Name(), err)
+		if errors.Is(err, errAborted) {
+			return Result{}, err
+		}
+		if result.Partial && len(result.Message) > len(best.Message) {
+			best = result
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		var rateLimitErr *RateLimitError
+		if errors.As(err, &rateLimitErr) && i+1 < len(providers) {
+			fmt.Fprintf(notices, "%s: %v; falling back to %s\n", p.Name(), rateLimitErr, providers[i+1].Name())
+		}
 	}
 
-	file, err := tree.File(filePath)
-	if err != nil {
-		if err == object.ErrFileNotFound {
-			return "", nil // 新規ファイルの場合は空文字列を返す
+	if errors.Is(context.Cause(ctx), errMaxTime) {
+		if best.Message != "" {
+			fmt.Fprintf(notices, "Warning: -max-time %s exceeded; using the partial message from %s\n", g.options.MaxTime, best.Provider)
+			return best, nil
 		}
-		return "", fmt.Errorf("getting file from tree: %w", err)
+		return Result{}, fmt.Errorf("no message within -max-time %s", g.options.MaxTime)
+	}
+	if ctx.Err() != nil {
+		return Result{}, ctx.Err()
 	}
 
-	return file.Contents()
+	return result, err
 }
 
-func (g *CommitMessageGenerator) getUnstagedFileContent(filePath string) (string, error) {
-	file, err := g.worktree.Filesystem.Open(filePath)
+// generateForModel fits patches into the model's context budget and asks it
+// for a commit message.
+func (g *CommitMessageGenerator) generateForModel(ctx context.Context, p Provider, patches []FilePatch) (Result, error) {
+	result := Result{Provider: p.Name(), Model: p.Model()}
+
+	counter, err := newTokenCounter(p.Model())
 	if err != nil {
-		return "", fmt.Errorf("opening file: %w", err)
+		return result, err
 	}
-	defer file.Close()
 
-	content, err := io.ReadAll(file)
-	if err != nil {
-		return "", fmt.Errorf("reading file contents: %w", err)
+	prompt := g.promptFor(p, patches, counter)
+	system, diff, scopes, breaking := prompt.System, prompt.User, prompt.Scopes, prompt.Breaking
+	result.Report = prompt.Report
+
+	cacheKey := g.responseCacheKey(p, prompt)
+	if !g.options.NoCache && !g.uncached {
+		if cached, ok := cachedResult(cacheKey); ok {
+			debugf("%s: using the cached response %s", p.Name(), cacheKey[:12])
+			return cached, nil
+		}
+	}
+	if err := g.confirmSend(p, patches, prompt); err != nil {
+		return result, err
+	}
+	spin.Status("asking %s…", p.Model())
+	debugf("%s: estimated %d system + %d diff tokens (budget %d)", p.Name(), counter.Count(system), counter.Count(diff),
+		counter.promptBudget(p.Model(), system, g.options.Sampling.MaxTokens))
+	if prompt.Report.Degraded() {
+		debugf("%s: %s", p.Name(), prompt.Report)
 	}
 
-	return string(content), nil
-}
+	// ask sends one request for n answers and decodes them, adding up the
+	// usage of every request made for this message.
+	ask := func(system string, n int) error {
+		resp, err := p.Generate(ctx, GenerateRequest{
+			System:     system,
+			User:       diff,
+			Sampling:   g.options.Sampling,
+			Structured: g.options.Structured,
+			N:          n,
+		})
+		if err != nil {
+			if resp.Content != "" && !g.options.Structured {
+				result.Message = cleanMessage(resp.Content)
+				result.Partial = true
+			}
+			return err
+		}
+		candidate, err := g.decodeCandidate(resp.Content)
+		result.Message, result.Structured = candidate.Message, candidate.Structured
+		if err != nil {
+			return err
+		}
 
-func (g *CommitMessageGenerator) lazyGenerateCommitMessage(diff string) (string, error) {
-	groqUrl, groqModel, groqAPIKey := "https://api.groq.com/openai/v1/chat/completions", "llama3-70b-8192", g.groqAPIKey
-	openAIUrl, openAIModel, openAIAPIKey := "https://api.openai.com/v1/chat/completions", "gpt-4o-mini-2024-07-18", g.openAIAPIKey
+		completion := resp.Content
+		for _, content := range resp.Alternatives {
+			completion += content
+			alternative, err := g.decodeCandidate(content)
+			if err != nil {
+				continue
+			}
+			result.Alternatives = append(result.Alternatives, alternative)
+		}
 
-	groqResp, err := g.generateCommitMessage(groqUrl, groqModel, diff, groqAPIKey)
-	if err != nil {
-		return g.generateCommitMessage(openAIUrl, openAIModel, diff, openAIAPIKey)
+		// Not every provider reports usage when streaming; count locally instead.
+		usage := resp.Usage
+		if usage == nil {
+			usage = &Usage{
+				PromptTokens:     counter.Count(system) + counter.Count(diff),
+				CompletionTokens: counter.Count(completion),
+			}
+		}
+		result.Usage.PromptTokens += usage.PromptTokens
+		result.Usage.CompletionTokens += usage.CompletionTokens
+		return nil
 	}
 
-	return groqResp, nil
-}
+	if err := ask(system, g.options.Candidates); err != nil {
+		return result, err
+	}
 
-func (g *CommitMessageGenerator) generateCommitMessage(
-	url string,
-	model string,
-	diff string,
-	apiKey string,
-) (string, error) {
-	requestBody := OpenAIRequest{
-		Model: model,
-		Messages: []Message{
-			{Role: "system", Content: systemPrompt},
-			{Role: "user", Content: diff},
-		},
+	if g.options.Conventional {
+		for retry := 0; ; retry++ {
+			problems := conventionalProblems(result.Message, scopes, len(breaking) > 0)
+			if len(problems) == 0 {
+				break
+			}
+			if retry == maxConventionalRetries {
+				return result, fmt.Errorf("message is not a Conventional Commit after %d retries: %s", retry, strings.Join(problems, "; "))
+			}
+			fmt.Fprintf(notices, "%s: not a Conventional Commit (%s); retrying\n", p.Name(), strings.Join(problems, "; "))
+			if err := ask(system+conventionalRetry(result.Message, problems), 0); err != nil {
+				return result, err
+			}
+		}
 	}
 
-	jsonBody, err := json.Marshal(requestBody)
-	if err != nil {
-		return "", fmt.Errorf("marshaling request body: %w", err)
+	if g.options.Conventional {
+		result.Alternatives = conventionalCandidates(result.Alternatives, scopes, len(breaking) > 0)
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return "", fmt.Errorf("creating request: %w", err)
+	if !g.uncached {
+		cacheResult(cacheKey, result)
 	}
+	return result, nil
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
+// Prompt is what is sent to a provider for one message.
+type Prompt struct {
+	System   string
+	User     string // The diff, fitted into the context budget
+	Report   DiffReport
+	Scopes   []string // Allowed with -conventional and -structured
+	Breaking []string // Detected breaking changes
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("sending request: %w", err)
+// promptFor assembles the system prompt for p from the options and context
+// and fits patches into what is left of its context window.
+func (g *CommitMessageGenerator) promptFor(p Provider, patches []FilePatch, counter *TokenCounter) Prompt {
+	var prompt Prompt
+	system := g.prompt
+	if g.options.Structured {
+		system += structuredPrompt
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("reading response body: %w", err)
+	if g.options.Conventional {
+		system += fmt.Sprintf(conventionalPrompt, strings.Join(conventionalTypes, ", "))
+	} else if g.options.Gitmoji && !g.options.Structured {
+		system += fmt.Sprintf(gitmojiPrompt, strings.Join(conventionalTypes, ", "))
 	}
-
-	var openAIResp OpenAIResponse
-	err = json.Unmarshal(body, &openAIResp)
-	if err != nil {
-		return "", fmt.Errorf("unmarshaling response: %w", err)
+	if g.options.Conventional || g.options.Structured {
+		prompt.Scopes = g.inferScopes(patches)
+		system += scopeConstraint(prompt.Scopes)
 	}
-
-	if len(openAIResp.Choices) == 0 {
-		return "", fmt.Errorf("no choices in response. Full response: %s", string(body))
+	if !g.options.Oneline {
+		// A single line has no room for the BREAKING CHANGE footer.
+		prompt.Breaking = detectBreakingChanges(patches)
+	}
+	if len(prompt.Breaking) > 0 {
+		system += breakingContext(prompt.Breaking, g.options.Conventional)
+	}
+	system += g.context
+	system += langContext(g.options.Lang)
+	system += g.options.verbosityContext()
+	system += g.refinement
+
+	prompt.System = system
+	prompt.User, prompt.Report = fitPatches(patches, counter.promptBudget(p.Model(), system, g.options.Sampling.MaxTokens), counter)
+	if prompt.User == "" && g.merge != nil {
+		prompt.User = "(no conflicts)\n"
 	}
+	return prompt
+}
 
-	commitMessage := openAIResp.Choices[0].Message.Content
-	commitMessage = strings.TrimSpace(commitMessage)
+// cleanMessage strips surrounding whitespace and code fences from a model
+// response.
+func cleanMessage(content string) string {
+	commitMessage := strings.TrimSpace(content)
 	commitMessage = strings.TrimPrefix(commitMessage, "```")
 	commitMessage = strings.TrimSuffix(commitMessage, "```")
-	commitMessage = strings.TrimSpace(commitMessage)
-
-	return commitMessage, nil
+	return strings.TrimSpace(commitMessage)
 }
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+const maxMergeLog = 50 // Merged commits listed in the prompt
+
+const mergePrompt = `
+
+# マージコミット
+
+これはマージコミットである。1行目にマージの要約を書き、空行の後に取り込まれる主な変更を箇条書きで記述すること。コンフリクトがあった場合は、その解消方法も記述すること。入力データはコンフリクトしたファイルの解消後の差分である。
+
+`
+
+// mergeState is an in-progress merge as left by `git merge`.
+type mergeState struct {
+	Heads     []plumbing.Hash
+	Title     string   // First line of MERGE_MSG, e.g. "Merge branch 'feature'"
+	Conflicts []string // Paths listed under "# Conflicts:" in MERGE_MSG
+}
+
+// gitDir returns the path of the git directory, or "" when the repository
+// is not stored on disk. In a linked worktree this is the worktree's own
+// directory under .git/worktrees, which holds its HEAD, index and state
+// files such as MERGE_HEAD.
+func (g *CommitMessageGenerator) gitDir() string {
+	if g.repo == nil {
+		return ""
+	}
+	fs, ok := g.repo.Storer.(*filesystem.Storage)
+	if !ok {
+		return ""
+	}
+	return fs.Filesystem().Root()
+}
+
+// commonDir returns the git directory shared by all worktrees: the one
+// named by the commondir file of a linked worktree, or gitDir otherwise.
+func (g *CommitMessageGenerator) commonDir() string {
+	dir := g.gitDir()
+	if dir == "" {
+		return ""
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "commondir"))
+	if err != nil {
+		return dir
+	}
+	common := strings.TrimSpace(string(data))
+	if !filepath.IsAbs(common) {
+		common = filepath.Join(dir, common)
+	}
+	return filepath.Clean(common)
+}
+
+// readMergeState reads MERGE_HEAD and MERGE_MSG. It returns nil when no
+// merge is in progress.
+func (g *CommitMessageGenerator) readMergeState() (*mergeState, error) {
+	dir := g.gitDir()
+	if dir == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "MERGE_HEAD"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading MERGE_HEAD: %w", err)
+	}
+
+	state := &mergeState{}
+	for _, line := range strings.Fields(string(data)) {
+		state.Heads = append(state.Heads, plumbing.NewHash(line))
+	}
+
+	msg, err := os.ReadFile(filepath.Join(dir, "MERGE_MSG"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading MERGE_MSG: %w", err)
+	}
+	inConflicts := false
+	for i, line := range strings.Split(string(msg), "\n") {
+		switch {
+		case i == 0:
+			state.Title = strings.TrimSpace(line)
+		case strings.HasPrefix(line, "# Conflicts:"):
+			inConflicts = true
+		case inConflicts && strings.HasPrefix(line, "#\t"):
+			state.Conflicts = append(state.Conflicts, strings.TrimPrefix(line, "#\t"))
+		case inConflicts && strings.TrimSpace(line) != "#":
+			inConflicts = false
+		}
+	}
+
+	return state, nil
+}
+
+// commitsBetween returns the commits reachable from head but not from
+// base, newest first. At most limit commits are returned; the second
+// result reports whether there were more.
+func (g *CommitMessageGenerator) commitsBetween(base plumbing.Hash, head plumbing.Hash, limit int) ([]*object.Commit, bool, error) {
+	seen := map[plumbing.Hash]bool{}
+	if !base.IsZero() {
+		baseCommit, err := g.repo.CommitObject(base)
+		if err != nil {
+			return nil, false, fmt.Errorf("getting commit %s: %w", base, err)
+		}
+		err = walkHistory(g.repo, baseCommit, nil).ForEach(func(c *object.Commit) error {
+			seen[c.Hash] = true
+			return nil
+		})
+		if err != nil {
+			return nil, false, fmt.Errorf("walking history of %s: %w", base, err)
+		}
+	}
+
+	headCommit, err := g.repo.CommitObject(head)
+	if err != nil {
+		return nil, false, fmt.Errorf("getting commit %s: %w", head, err)
+	}
+
+	var commits []*object.Commit
+	more := false
+	err = walkHistory(g.repo, headCommit, seen).ForEach(func(c *object.Commit) error {
+		if len(commits) == limit {
+			more = true
+			return storer.ErrStop
+		}
+		commits = append(commits, c)
+		return nil
+	})
+	if err != nil && !errors.Is(err, storer.ErrStop) {
+		return nil, false, fmt.Errorf("walking history of %s: %w", head, err)
+	}
+
+	return commits, more, nil
+}
+
+// commitLog lists the commits reachable from head but not from base as
+// "<short hash> <subject>" lines, newest first, up to limit lines.
+func (g *CommitMessageGenerator) commitLog(base plumbing.Hash, head plumbing.Hash, limit int) ([]string, error) {
+	commits, more, err := g.commitsBetween(base, head, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var log []string
+	for _, c := range commits {
+		subject, _, _ := strings.Cut(c.Message, "\n")
+		log = append(log, fmt.Sprintf("%s %s", c.Hash.String()[:7], subject))
+	}
+	if more {
+		log = append(log, "...")
+	}
+	return log, nil
+}
+
+// mergeContext describes the merge for the system prompt: its default
+// title, the commits being merged and the files that conflicted.
+func (g *CommitMessageGenerator) mergeContext(state *mergeState) (string, error) {
+	var head plumbing.Hash
+	if ref, err := g.repo.Head(); err == nil {
+		head = ref.Hash()
+	} else if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return "", fmt.Errorf("getting HEAD: %w", err)
+	}
+
+	var b strings.Builder
+	b.WriteString(mergePrompt)
+	if state.Title != "" {
+		fmt.Fprintf(&b, "既定のメッセージ: %s\n", state.Title)
+	}
+	for _, merged := range state.Heads {
+		log, err := g.commitLog(head, merged, maxMergeLog)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "\nマージされるコミット (%s):\n", merged.String()[:7])
+		for _, line := range log {
+			fmt.Fprintf(&b, "- %s\n", line)
+		}
+	}
+	if len(state.Conflicts) > 0 {
+		b.WriteString("\nコンフリクトしたファイル:\n")
+		for _, path := range state.Conflicts {
+			fmt.Fprintf(&b, "- %s\n", path)
+		}
+	} else {
+		b.WriteString("\nコンフリクトはなかった。\n")
+	}
+
+	return b.String(), nil
+}
+
+// conflictPatches keeps the patches of files that conflicted, which show
+// how the conflicts were resolved.
+func conflictPatches(patches []FilePatch, state *mergeState) []FilePatch {
+	conflicted := map[string]bool{}
+	for _, path := range state.Conflicts {
+		conflicted[path] = true
+	}
+
+	var kept []FilePatch
+	for _, p := range patches {
+		if conflicted[p.Path] {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+// RepoMetadata describes the repository a message is generated for. It is
+// exposed to message templates alongside the generated message, and to
+// -trailer values.
+type RepoMetadata struct {
+	Repo        string
+	Branch      string
+	Tag         string
+	Dirs        []string
+	AuthorName  string
+	AuthorEmail string
+}
+
+// TemplateData is the value message templates are executed against.
+type TemplateData struct {
+	RepoMetadata
+	Message  string
+	Subject  string
+	Body     string // Without the trailers
+	Trailers string // Trailer block such as "Signed-off-by: ...", if any
+	Type     string // Change type; structured output only
+	Scope    string
+	Breaking bool
+}
+
+// templateStructured matches templates that need the type or scope of the
+// change, which only a structured response carries.
+var templateStructured = regexp.MustCompile(`\.(Type|Scope|Breaking)\b`)
+
+// blankLines matches the runs of blank lines left by empty fields.
+var blankLines = regexp.MustCompile(`\n\s*\n(\s*\n)+`)
+
+func (g *CommitMessageGenerator) getRepoMetadata(patches []FilePatch) (RepoMetadata, error) {
+	var meta RepoMetadata
+
+	meta.Dirs = changedDirs(patches)
+	if g.repo == nil {
+		return meta, nil // Diff read from stdin outside a repository
+	}
+
+	meta.Repo = g.repoName()
+
+	// Named even before its first commit
+	branch, err := g.currentBranch()
+	if err != nil {
+		return meta, err
+	}
+	meta.Branch = branch
+
+	head, err := g.repo.Head()
+	if err != nil && !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return meta, fmt.Errorf("getting HEAD: %w", err)
+	}
+	if head != nil {
+		meta.Tag, err = g.nearestTag(head.Hash())
+		if err != nil {
+			return meta, err
+		}
+	}
+
+	cfg, err := g.repo.ConfigScoped(config.GlobalScope)
+	if err != nil {
+		return meta, fmt.Errorf("reading git config: %w", err)
+	}
+	meta.AuthorName = cfg.User.Name
+	meta.AuthorEmail = cfg.User.Email
+
+	return meta, nil
+}
+
+// changedDirs returns the top-level directories touched by patches, with
+// "." standing for files at the root.
+func changedDirs(patches []FilePatch) []string {
+	dirs := map[string]bool{}
+	for _, p := range patches {
+		dir, _, found := strings.Cut(p.Path, "/")
+		if !found {
+			dir = "."
+		}
+		dirs[dir] = true
+	}
+
+	var sorted []string
+	for dir := range dirs {
+		sorted = append(sorted, dir)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// repoName returns the name of the repository directory, without the
+// ".git" suffix bare repositories usually carry. Linked worktrees are named
+// after the main worktree rather than their own directory.
+func (g *CommitMessageGenerator) repoName() string {
+	if common := g.commonDir(); common != "" && common != g.gitDir() {
+		if filepath.Base(common) == ".git" {
+			return filepath.Base(filepath.Dir(common))
+		}
+		return strings.TrimSuffix(filepath.Base(common), ".git")
+	}
+	if g.worktree != nil {
+		return filepath.Base(g.worktree.Filesystem.Root())
+	}
+	if fs, ok := g.repo.Storer.(*filesystem.Storage); ok {
+		return strings.TrimSuffix(filepath.Base(fs.Filesystem().Root()), ".git")
+	}
+	return ""
+}
+
+// nearestTag returns the name of the closest tag reachable from hash, or ""
+// when no tag is reachable.
+func (g *CommitMessageGenerator) nearestTag(hash plumbing.Hash) (string, error) {
+	tagRefs, err := g.repo.Tags()
+	if err != nil {
+		return "", fmt.Errorf("listing tags: %w", err)
+	}
+
+	tags := map[plumbing.Hash]string{}
+	err = tagRefs.ForEach(func(ref *plumbing.Reference) error {
+		target := ref.Hash()
+		if tag, err := g.repo.TagObject(target); err == nil {
+			target = tag.Target
+		}
+		tags[target] = ref.Name().Short()
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("resolving tags: %w", err)
+	}
+	if len(tags) == 0 {
+		return "", nil
+	}
+
+	from, err := g.repo.CommitObject(hash)
+	if err != nil {
+		return "", fmt.Errorf("getting commit %s: %w", hash, err)
+	}
+	commits := walkHistory(g.repo, from, nil)
+	defer commits.Close()
+
+	var nearest string
+	err = commits.ForEach(func(c *object.Commit) error {
+		if name, ok := tags[c.Hash]; ok {
+			nearest = name
+			return storer.ErrStop
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("walking history: %w", err)
+	}
+
+	return nearest, nil
+}
+
+// applyTemplate renders message through the user supplied template text.
+func applyTemplate(text string, message string, structured *StructuredMessage, meta RepoMetadata) (string, error) {
+	tmpl, err := template.New("message").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("parsing template: %w", err)
+	}
+
+	rest, trailers := splitTrailers(message)
+	subject, body, _ := strings.Cut(rest, "\n")
+	data := TemplateData{
+		RepoMetadata: meta,
+		Message:      message,
+		Subject:      strings.TrimSpace(subject),
+		Body:         strings.TrimSpace(body),
+		Trailers:     trailers,
+	}
+	if structured != nil {
+		data.Type = strings.TrimSpace(structured.Type)
+		data.Scope = strings.TrimSpace(structured.Scope)
+		data.Breaking = strings.Contains(message, "BREAKING CHANGE: ")
+		// The template lays out the type and scope itself.
+		if m := conventionalHeader.FindStringSubmatch(data.Subject); m != nil {
+			data.Subject = m[5]
+			data.Breaking = data.Breaking || m[4] != ""
+		}
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("executing template: %w", err)
+	}
+
+	return strings.TrimSpace(blankLines.ReplaceAllString(out.String(), "\n\n")), nil
+}
+
+// templateTrailer reports whether a trailer value is a template.
+func templateTrailer(t Trailer) bool {
+	return strings.Contains(t.Value, "{{")
+}
+
+// expandTrailers executes the trailer values that are templates against
+// meta, as in -trailer 'Branch: {{.Branch}}'. A trailer that comes out
+// empty, such as {{.Tag}} without a tag, is dropped.
+func expandTrailers(trailers []Trailer, meta RepoMetadata) ([]Trailer, error) {
+	var expanded []Trailer
+	for _, t := range trailers {
+		if !templateTrailer(t) {
+			expanded = append(expanded, t)
+			continue
+		}
+		tmpl, err := template.New(t.Key).Option("missingkey=error").Parse(t.Value)
+		if err != nil {
+			return nil, fmt.Errorf("parsing trailer %s: %w", t.Key, err)
+		}
+		var out strings.Builder
+		if err := tmpl.Execute(&out, meta); err != nil {
+			return nil, fmt.Errorf("executing trailer %s: %w", t.Key, err)
+		}
+		// A trailer is a single line.
+		if value := strings.Join(strings.Fields(out.String()), " "); value != "" {
+			expanded = append(expanded, Trailer{Key: t.Key, Value: value})
+		}
+	}
+	return expanded, nil
+}
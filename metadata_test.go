@@ -0,0 +1,55 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExpandTrailers(t *testing.T) {
+	meta := RepoMetadata{Repo: "autogcm", Branch: "release/1.4", Dirs: []string{"cmd", "docs"}, AuthorName: "Aoi"}
+	tests := []struct {
+		name     string
+		trailers []Trailer
+		want     []Trailer
+	}{
+		{
+			name:     "plain values are kept",
+			trailers: []Trailer{{"Reviewed-by", "Ren <ren@example.com>"}},
+			want:     []Trailer{{"Reviewed-by", "Ren <ren@example.com>"}},
+		},
+		{
+			name:     "metadata",
+			trailers: []Trailer{{"Branch", "{{.Branch}}"}, {"Component", "{{.Repo}}/{{index .Dirs 0}}"}},
+			want:     []Trailer{{"Branch", "release/1.4"}, {"Component", "autogcm/cmd"}},
+		},
+		{
+			name:     "empty values are dropped",
+			trailers: []Trailer{{"Release", "{{.Tag}}"}, {"Author", "{{.AuthorName}}"}},
+			want:     []Trailer{{"Author", "Aoi"}},
+		},
+		{
+			name:     "kept on one line",
+			trailers: []Trailer{{"Dirs", "{{range .Dirs}}\n{{.}}{{end}}"}},
+			want:     []Trailer{{"Dirs", "cmd docs"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandTrailers(tt.trailers, meta)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandTrailersErrors(t *testing.T) {
+	for _, value := range []string{"{{.Branch", "{{.Subject}}"} {
+		if got, err := expandTrailers([]Trailer{{"X", value}}, RepoMetadata{}); err == nil {
+			t.Errorf("expandTrailers(%q) = %v, want an error", value, got)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// usageEvent is one request to a provider as recorded by -metrics. It
+// holds no code, prompt, message or error text.
+type usageEvent struct {
+	Time             time.Time `json:"time"`
+	Provider         string    `json:"provider"`
+	Model            string    `json:"model"`
+	LatencyMS        int64     `json:"latency_ms"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	OK               bool      `json:"ok"`
+	Failure          string    `json:"failure,omitempty"` // rate-limited, unreachable, timeout or error
+	Cached           bool      `json:"cached,omitempty"`
+}
+
+// statsFile returns where -metrics records requests,
+// $XDG_STATE_HOME/autogcm/stats.jsonl or ~/.local/state/autogcm/stats.jsonl.
+func statsFile() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "autogcm", "stats.jsonl"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("locating state directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "state", "autogcm", "stats.jsonl"), nil
+}
+
+// failureKind names the class of a provider error without its text,
+// which may quote the response.
+func failureKind(err error) string {
+	var rateLimitErr *RateLimitError
+	switch {
+	case errors.As(err, &rateLimitErr):
+		return "rate-limited"
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, errMaxTime):
+		return "timeout"
+	case isUnreachable(err):
+		return "unreachable"
+	}
+	return "error"
+}
+
+// recordUsage appends a request to p to the stats file when -metrics is
+// given. Recording is best effort, so failures are only logged.
+func (g *CommitMessageGenerator) recordUsage(p Provider, result Result, err error, latency time.Duration) {
+	if !g.options.Metrics || errors.Is(err, errAborted) {
+		return
+	}
+	event := usageEvent{
+		Time:             time.Now().UTC(),
+		Provider:         p.Name(),
+		Model:            p.Model(),
+		LatencyMS:        latency.Milliseconds(),
+		PromptTokens:     result.Usage.PromptTokens,
+		CompletionTokens: result.Usage.CompletionTokens,
+		OK:               err == nil,
+		Cached:           result.Cached,
+	}
+	if err != nil {
+		event.Failure = failureKind(err)
+	}
+
+	path, err := statsFile()
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0o700)
+	}
+	var f *os.File
+	if err == nil {
+		f, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	}
+	if err != nil {
+		debugf("recording usage: %v", err)
+		return
+	}
+	defer f.Close()
+	line, _ := json.Marshal(event)
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		debugf("recording usage: %v", err)
+	}
+}
+
+// runStats implements `autogcm stats`, summarizing the recorded requests
+// per provider and model.
+func runStats(args []string, out io.Writer) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: autogcm stats")
+	}
+	path, err := statsFile()
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintln(out, "No usage recorded yet; run autogcm with -metrics (or metrics: true in the config file) to record it.")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading stats: %w", err)
+	}
+	defer f.Close()
+
+	type summary struct {
+		provider, model      string
+		requests, ok, cached int
+		failures             map[string]int
+		latencies            []int64 // Of answered, uncached requests
+		usage                Usage
+		first                time.Time
+	}
+	summaries := map[string]*summary{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e usageEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		key := e.Provider + "\x00" + e.Model
+		s := summaries[key]
+		if s == nil {
+			s = &summary{provider: e.Provider, model: e.Model, failures: map[string]int{}, first: e.Time}
+			summaries[key] = s
+		}
+		s.requests++
+		switch {
+		case e.Cached:
+			s.cached++
+		case e.OK:
+			s.ok++
+			s.latencies = append(s.latencies, e.LatencyMS)
+		default:
+			s.failures[e.Failure]++
+		}
+		s.usage.PromptTokens += e.PromptTokens
+		s.usage.CompletionTokens += e.CompletionTokens
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading stats: %w", err)
+	}
+
+	keys := sortedKeys(summaries)
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROVIDER\tMODEL\tREQUESTS\tOK\tCACHED\tFAILED\tP50\tP95\tTOKENS IN/OUT\tEST. COST\tSINCE")
+	for _, key := range keys {
+		s := summaries[key]
+		failed := 0
+		for _, n := range s.failures {
+			failed += n
+		}
+		cost := "-"
+		if c, ok := estimateCost(s.model, s.usage); ok {
+			cost = fmt.Sprintf("$%.4f", c)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\t%s\t%s\t%d/%d\t%s\t%s\n",
+			s.provider, s.model, s.requests, s.ok, s.cached, failed,
+			percentile(s.latencies, 50), percentile(s.latencies, 95),
+			s.usage.PromptTokens, s.usage.CompletionTokens, cost, s.first.Local().Format("2006-01-02"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		s := summaries[key]
+		for _, kind := range sortedKeys(s.failures) {
+			fmt.Fprintf(out, "%s %s: %d %s\n", s.provider, s.model, s.failures[kind], kind)
+		}
+	}
+	return nil
+}
+
+// percentile returns the p-th percentile of latencies in milliseconds,
+// formatted as a duration, or "-" when there are none.
+func percentile(latencies []int64, p int) string {
+	if len(latencies) == 0 {
+		return "-"
+	}
+	sorted := append([]int64(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := (len(sorted)*p+99)/100 - 1
+	return (time.Duration(sorted[max(i, 0)]) * time.Millisecond).String()
+}
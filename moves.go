@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+const minDirectoryMove = 3 // Unchanged renames between the same directories collapsed into one item
+const maxMovedNames = 10   // Moved files listed by name
+
+// pureRename returns the old and new path of a patch that only renames a
+// file without changing its content.
+func pureRename(patch string) (string, string, bool) {
+	var from, to string
+	unchanged := false
+	for _, line := range strings.Split(patch, "\n") {
+		switch {
+		case strings.HasPrefix(line, "rename from "):
+			from = strings.TrimPrefix(line, "rename from ")
+		case strings.HasPrefix(line, "rename to "):
+			to = strings.TrimPrefix(line, "rename to ")
+		case line == "similarity index 100%":
+			unchanged = true
+		case strings.HasPrefix(line, "@@ "), strings.HasPrefix(line, "old mode "):
+			return "", "", false
+		}
+	}
+	return from, to, unchanged && from != "" && to != ""
+}
+
+// movedDirs strips the longest common trailing path components of a
+// rename, so that "a/x/f.go" → "b/x/f.go" becomes the move "a" → "b". A
+// file that was also renamed moves between its parent directories.
+func movedDirs(from string, to string) (string, string) {
+	if path.Base(from) != path.Base(to) {
+		return path.Dir(from), path.Dir(to)
+	}
+	a, b := strings.Split(path.Dir(from), "/"), strings.Split(path.Dir(to), "/")
+	for len(a) > 1 && len(b) > 1 && a[len(a)-1] == b[len(b)-1] {
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+	return strings.Join(a, "/"), strings.Join(b, "/")
+}
+
+// summarizeMoves collapses unchanged renames between the same pair of
+// directories, as left by a package rename, into a single item, so that
+// the model sees one relocation rather than many separate files.
+func summarizeMoves(patches []FilePatch) []FilePatch {
+	type move struct{ from, to string }
+	groups := map[move][]int{}
+	for i, p := range patches {
+		from, to, ok := pureRename(p.Patch)
+		if !ok {
+			continue
+		}
+		fromDir, toDir := movedDirs(from, to)
+		groups[move{fromDir, toDir}] = append(groups[move{fromDir, toDir}], i)
+	}
+
+	collapsed := map[int]FilePatch{}
+	skipped := map[int]bool{}
+	for m, indexes := range groups {
+		if len(indexes) < minDirectoryMove || m.from == m.to {
+			continue
+		}
+		names := make([]string, len(indexes))
+		for j, i := range indexes {
+			names[j] = strings.TrimPrefix(patches[i].Path, m.to+"/")
+			skipped[i] = true
+		}
+		sort.Strings(names)
+		if len(names) > maxMovedNames {
+			names = append(names[:maxMovedNames], fmt.Sprintf("and %d more", len(indexes)-maxMovedNames))
+		}
+		collapsed[indexes[0]] = FilePatch{
+			Path: m.to,
+			Patch: fmt.Sprintf("Moved %d files from %s/ to %s/ (contents unchanged; a relocation such as a package rename): %s\n",
+				len(indexes), m.from, m.to, strings.Join(names, ", ")),
+		}
+	}
+	if len(collapsed) == 0 {
+		return patches
+	}
+
+	var result []FilePatch
+	for i, p := range patches {
+		if summary, ok := collapsed[i]; ok {
+			result = append(result, summary)
+		} else if !skipped[i] {
+			result = append(result, p)
+		}
+	}
+	return result
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func renamePatch(from string, to string) string {
+	return fmt.Sprintf("diff --git a/%s b/%s\nsimilarity index 100%%\nrename from %s\nrename to %s\n", from, to, from, to)
+}
+
+func TestPureRename(t *testing.T) {
+	tests := []struct {
+		name     string
+		patch    string
+		from, to string
+		ok       bool
+	}{
+		{"unchanged rename", renamePatch("a/f.go", "b/f.go"), "a/f.go", "b/f.go", true},
+		{"rename with edits", "similarity index 90%\nrename from a/f.go\nrename to b/f.go\n@@ -1 +1 @@\n-x\n+y\n", "", "", false},
+		{"rename with mode change", "old mode 100644\nnew mode 100755\nsimilarity index 100%\nrename from a/f.sh\nrename to b/f.sh\n", "", "", false},
+		{"modification", "--- a/f.go\n+++ b/f.go\n@@ -1 +1 @@\n-x\n+y\n", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, ok := pureRename(tt.patch)
+			if from != tt.from || to != tt.to || ok != tt.ok {
+				t.Errorf("got %q, %q, %v; want %q, %q, %v", from, to, ok, tt.from, tt.to, tt.ok)
+			}
+		})
+	}
+}
+
+func TestMovedDirs(t *testing.T) {
+	tests := []struct {
+		from, to         string
+		wantFrom, wantTo string
+	}{
+		{"internal/old/x/f.go", "internal/new/x/f.go", "internal/old", "internal/new"},
+		{"pkg/a/f.go", "lib/a/f.go", "pkg", "lib"},
+		{"a/f.go", "b/g.go", "a", "b"},
+		{"a/x/f.go", "a/x/g.go", "a/x", "a/x"},
+	}
+	for _, tt := range tests {
+		fromDir, toDir := movedDirs(tt.from, tt.to)
+		if fromDir != tt.wantFrom || toDir != tt.wantTo {
+			t.Errorf("movedDirs(%q, %q) = %q, %q; want %q, %q", tt.from, tt.to, fromDir, toDir, tt.wantFrom, tt.wantTo)
+		}
+	}
+}
+
+func TestSummarizeMoves(t *testing.T) {
+	moved := func(names ...string) []FilePatch {
+		var patches []FilePatch
+		for _, name := range names {
+			patches = append(patches, FilePatch{Path: "new/" + name, Patch: renamePatch("old/"+name, "new/"+name)})
+		}
+		return patches
+	}
+	edit := FilePatch{Path: "main.go", Patch: "@@ -1 +1 @@\n-x\n+y\n"}
+
+	tests := []struct {
+		name    string
+		patches []FilePatch
+		want    []string // Paths of the result, in order
+		summary string   // Expected in the collapsed item, if any
+	}{
+		{
+			name:    "package rename",
+			patches: append([]FilePatch{edit}, moved("a.go", "b.go", "c.go")...),
+			want:    []string{"main.go", "new"},
+			summary: "Moved 3 files from old/ to new/ (contents unchanged; a relocation such as a package rename): a.go, b.go, c.go\n",
+		},
+		{
+			name:    "too few to collapse",
+			patches: append(moved("a.go", "b.go"), edit),
+			want:    []string{"new/a.go", "new/b.go", "main.go"},
+		},
+		{
+			name:    "long lists are cut",
+			patches: moved("a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l"),
+			want:    []string{"new"},
+			summary: "a, b, c, d, e, f, g, h, i, j, and 2 more\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := summarizeMoves(tt.patches)
+			var paths []string
+			for _, p := range got {
+				paths = append(paths, p.Path)
+			}
+			if strings.Join(paths, " ") != strings.Join(tt.want, " ") {
+				t.Fatalf("paths %q, want %q", paths, tt.want)
+			}
+			if tt.summary != "" && !strings.HasSuffix(got[len(got)-1].Patch, tt.summary) {
+				t.Errorf("summary %q, want it to end in %q", got[len(got)-1].Patch, tt.summary)
+			}
+		})
+	}
+}
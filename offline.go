@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"strings"
+)
+
+const offlineProvider = "offline"
+
+const maxOfflineFiles = 20 // Files listed in the body of an offline message
+
+// isUnreachable reports whether err means the provider could not be
+// reached at all, as opposed to it refusing or failing the request.
+func isUnreachable(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || isTransientError(err)
+}
+
+// offlineResult writes a message without a model, for -offline-fallback:
+// the subject comes from what most of the changed lines are (source,
+// tests, docs, ...) and whether files were added or removed, the body is
+// a diffstat.
+func (g *CommitMessageGenerator) offlineResult(patches []FilePatch) Result {
+	lines := map[int]int{}
+	var added, deleted int
+	var body strings.Builder
+	for i, p := range patches {
+		plus, minus := diffstat(p.Patch)
+		lines[relevanceRank(p)] += plus + minus
+		switch {
+		case strings.Contains(p.Patch, "\nnew file mode "):
+			added++
+		case strings.Contains(p.Patch, "\ndeleted file mode "):
+			deleted++
+		}
+		if i < maxOfflineFiles {
+			body.WriteString(diffstatLine(p))
+		}
+	}
+	if len(patches) > maxOfflineFiles {
+		fmt.Fprintf(&body, " ... and %d more files\n", len(patches)-maxOfflineFiles)
+	}
+
+	dominant := rankSource
+	for rank := rankGenerated; rank >= rankSource; rank-- {
+		if lines[rank] >= lines[dominant] {
+			dominant = rank
+		}
+	}
+
+	verb := "Update"
+	switch {
+	case added == len(patches):
+		verb = "Add"
+	case deleted == len(patches):
+		verb = "Remove"
+	}
+
+	what := fmt.Sprintf("%d files", len(patches))
+	scopes := g.inferScopes(patches)
+	switch {
+	case len(patches) == 1:
+		what = path.Base(patches[0].Path)
+	case len(scopes) == 1:
+		what += " in " + scopes[0]
+	}
+
+	subject := verb + " " + what
+	if g.options.Conventional {
+		changeType := map[int]string{
+			rankSource:    "refactor",
+			rankTest:      "test",
+			rankDocs:      "docs",
+			rankConfig:    "build",
+			rankGenerated: "chore",
+		}[dominant]
+		if dominant == rankSource && added > 0 && added >= len(patches)/2 {
+			changeType = "feat"
+		}
+		header := changeType
+		if allowed := allowedScopes(scopes); len(allowed) == 1 {
+			header += "(" + allowed[0] + ")"
+		}
+		subject = header + ": " + strings.ToLower(verb) + " " + what
+	}
+
+	return Result{
+		Message:  subject + "\n\n" + strings.TrimRight(body.String(), "\n"),
+		Provider: offlineProvider,
+		Model:    offlineProvider,
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Output formats for -format.
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// MessageJSON is a commit message split into its parts for -format json.
+type MessageJSON struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+	Type    string `json:"type"`
+	Scope   string `json:"scope"`
+}
+
+// ResultJSON is what -format json prints: the chosen message, how it was
+// produced and whether the diff the model saw was cut short.
+type ResultJSON struct {
+	MessageJSON
+	Provider     string        `json:"provider"`
+	Model        string        `json:"model"`
+	Tokens       Usage         `json:"tokens"`
+	Truncated    bool          `json:"truncated"`
+	Cached       bool          `json:"cached,omitempty"` // Reused from an earlier run instead of asking the model
+	Report       *DiffReport   `json:"report,omitempty"` // Which files were left out, when truncated
+	Alternatives []MessageJSON `json:"alternatives,omitempty"`
+	Explanation  string        `json:"explanation,omitempty"` // With -explain
+}
+
+// messageJSON splits message into subject and body, and takes the type and
+// scope from its Conventional Commits header, or else from structured.
+func messageJSON(message string, structured *StructuredMessage) MessageJSON {
+	subject, body, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	m := MessageJSON{Subject: strings.TrimSpace(subject), Body: strings.TrimSpace(body)}
+	if header := conventionalHeader.FindStringSubmatch(m.Subject); header != nil {
+		m.Type, m.Scope = header[1], header[3]
+	} else if structured != nil {
+		m.Type, m.Scope = strings.TrimSpace(structured.Type), strings.TrimSpace(structured.Scope)
+	}
+	return m
+}
+
+// printJSON writes message and its alternatives as a single JSON object.
+// structured is the model's answer for message, if it was structured.
+func printJSON(w io.Writer, result Result, message string, structured *StructuredMessage, alternatives []string, explanation string) error {
+	out := ResultJSON{
+		MessageJSON: messageJSON(message, structured),
+		Provider:    result.Provider,
+		Model:       result.Model,
+		Tokens:      result.Usage,
+		Truncated:   result.Partial || result.Report.Degraded(),
+		Cached:      result.Cached,
+		Explanation: explanation,
+	}
+	if result.Report.Degraded() {
+		out.Report = &result.Report
+	}
+	for _, alternative := range alternatives {
+		out.Alternatives = append(out.Alternatives, messageJSON(alternative, nil))
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(out); err != nil {
+		return fmt.Errorf("writing JSON: %w", err)
+	}
+	return nil
+}
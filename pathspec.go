@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// pathspec limits the diff to matching files, like the pathspecs of
+// `git diff -- <path>...`. An empty pathspec matches everything.
+type pathspec []*regexp.Regexp
+
+// newPathspec resolves args given relative to dir into patterns relative
+// to the worktree root. A pattern matches a file itself or anything below
+// it; `*`, `?` and `[...]` are wildcards, and `*` also matches `/`.
+// Without a worktree (bare repositories) args are taken relative to the
+// repository root.
+func newPathspec(dir string, root string, args []string) (pathspec, error) {
+	var spec pathspec
+	for _, arg := range args {
+		rel := filepath.Clean(arg)
+		if root != "" {
+			var err error
+			if rel, err = relativeToRoot(dir, root, arg); err != nil {
+				return nil, err
+			}
+		}
+		rel = filepath.ToSlash(rel)
+
+		pattern := "" // The root itself matches everything
+		if rel != "." {
+			pattern = "^" + globToRegexp(rel) + "(/.*)?$"
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pathspec %q: %w", arg, err)
+		}
+		spec = append(spec, re)
+	}
+	return spec, nil
+}
+
+func relativeToRoot(dir string, root string, arg string) (string, error) {
+	base, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("resolving %s: %w", dir, err)
+	}
+	if resolved, err := filepath.EvalSymlinks(base); err == nil {
+		base = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+
+	path := arg
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(base, path)
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("pathspec %q is outside the repository", arg)
+	}
+	return rel, nil
+}
+
+// globToRegexp translates the wildcards of a pathspec into a regular
+// expression, quoting everything else.
+func globToRegexp(glob string) string {
+	var re strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			re.WriteString(".*")
+		case '?':
+			re.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				re.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return re.String()
+}
+
+// Match reports whether any of the given paths is selected.
+func (p pathspec) Match(paths ...string) bool {
+	if len(p) == 0 {
+		return true
+	}
+	for _, re := range p {
+		for _, path := range paths {
+			if path != "" && re.MatchString(path) {
+				return true
+			}
+		}
+	}
+	return false
+}
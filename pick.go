@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// isTerminal reports whether f is a character device such as a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// pickMessage shows the candidates on out and lets the user accept one,
+// edit one in place, have one revised or all regenerated, or abort. Only
+// the accepted message is returned, so stdout carries nothing else.
+// regenerate starts over when instruction is empty and revises previous
+// otherwise.
+func pickMessage(messages []string, regenerate func(previous string, instruction string) ([]string, error), in io.Reader, out io.Writer) (string, error) {
+	reader := bufio.NewReader(in)
+	for {
+		for i, message := range messages {
+			fmt.Fprintf(out, "\n--- %d ---\n%s\n", i+1, message)
+		}
+		fmt.Fprintln(out)
+		if len(messages) == 1 {
+			fmt.Fprint(out, "Enter to accept, 'e' to edit, 'r' to revise or regenerate, 'q' to abort: ")
+		} else {
+			fmt.Fprintf(out, "Enter to accept 1, 1-%d to accept another, 'e N' to edit, 'r N' to revise or regenerate, 'q' to abort: ", len(messages))
+		}
+
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			if err == io.EOF {
+				return "", errAborted
+			}
+			return "", fmt.Errorf("reading choice: %w", err)
+		}
+		line = strings.TrimSpace(line)
+
+		switch {
+		case line == "":
+			return messages[0], nil
+		case line == "q":
+			return "", errAborted
+		case line == "r" || strings.HasPrefix(line, "r "):
+			n, ok := candidateNumber(strings.TrimPrefix(line, "r"), len(messages))
+			if !ok {
+				fmt.Fprintln(out, "No such candidate.")
+				continue
+			}
+			fmt.Fprint(out, "How should it change? (Enter to regenerate from scratch): ")
+			instruction, err := reader.ReadString('\n')
+			if err != nil && instruction == "" {
+				return "", fmt.Errorf("reading instruction: %w", err)
+			}
+			instruction = strings.TrimSpace(instruction)
+			if instruction == "" {
+				fmt.Fprintln(out, "Regenerating...")
+			} else {
+				fmt.Fprintln(out, "Revising...")
+			}
+			regenerated, err := regenerate(messages[n-1], instruction)
+			if err != nil {
+				fmt.Fprintf(out, "Regenerating failed: %v\n", err)
+				continue
+			}
+			messages = regenerated
+		case line == "e" || strings.HasPrefix(line, "e "):
+			n, ok := candidateNumber(strings.TrimPrefix(line, "e"), len(messages))
+			if !ok {
+				fmt.Fprintln(out, "No such candidate.")
+				continue
+			}
+			edited, err := editInline(reader, out, messages[n-1])
+			if err != nil {
+				return "", err
+			}
+			messages[n-1] = edited
+		default:
+			n, err := strconv.Atoi(line)
+			if err != nil || n < 1 || n > len(messages) {
+				fmt.Fprintf(out, "Ignoring %q.\n", line)
+				continue
+			}
+			return messages[n-1], nil
+		}
+	}
+}
+
+// candidateNumber parses the optional candidate number after a command
+// key, defaulting to the first candidate.
+func candidateNumber(arg string, count int) (int, bool) {
+	arg = strings.TrimSpace(arg)
+	if arg == "" {
+		return 1, true
+	}
+	n, err := strconv.Atoi(arg)
+	return n, err == nil && n >= 1 && n <= count
+}
+
+// editInline reads a replacement message line by line, ending at a line
+// holding only ".". A line holding only "=" keeps the original line at
+// that position, so fixing the subject does not mean retyping the body.
+func editInline(reader *bufio.Reader, out io.Writer, message string) (string, error) {
+	original := strings.Split(message, "\n")
+	fmt.Fprintln(out, "Type the new message; '=' keeps the original line, '.' on its own line finishes, '.' right away keeps the message:")
+
+	var lines []string
+	for {
+		fmt.Fprintf(out, "%3d| ", len(lines)+1)
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			if err == io.EOF {
+				break
+			}
+			return "", fmt.Errorf("reading message: %w", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "." {
+			break
+		}
+		if line == "=" {
+			if len(lines) < len(original) {
+				line = original[len(lines)]
+			} else {
+				line = ""
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	edited := strings.TrimSpace(strings.Join(lines, "\n"))
+	if edited == "" {
+		return message, nil
+	}
+	return edited, nil
+}
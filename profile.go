@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const styleFile = ".autogcm/styles.yaml" // Committed with the repository
+
+const styleProfilePrompt = `
+
+# 書き方の規約（%s）
+
+このリポジトリでは次の規約でコミットメッセージを書く。これまでの条件と食い違う場合はこちらを優先すること。
+
+`
+
+// StyleProfile is a named set of message conventions selected with -style.
+// Options left at their zero value keep the command line setting.
+type StyleProfile struct {
+	Description  string `yaml:"description"`
+	Prompt       string `yaml:"prompt"`
+	Conventional bool   `yaml:"conventional"`
+	Gitmoji      bool   `yaml:"gitmoji"`
+	Lang         string `yaml:"lang"`
+	SubjectLimit int    `yaml:"subject-limit"`
+	Wrap         int    `yaml:"wrap"`
+}
+
+// builtinStyles are available in every repository; styles.yaml may
+// redefine them.
+var builtinStyles = map[string]StyleProfile{
+	"conventional": {
+		Description:  "Conventional Commits 1.0.0",
+		Conventional: true,
+	},
+	"angular": {
+		Description: "Angular commit message guidelines",
+		Prompt: `- 1行目は type(scope): subject とし、type は build, ci, docs, feat, fix, perf, refactor, test のいずれか
+- subject は英語の命令形・現在形で書き、先頭を小文字にして末尾にピリオドを付けない
+- 本文も命令形・現在形で書き、変更の動機と以前の振る舞いとの違いを説明する`,
+		Conventional: true,
+		Lang:         "en",
+		SubjectLimit: 100,
+		Wrap:         100,
+	},
+	"kernel": {
+		Description: "Linux kernel style (subsystem: summary)",
+		Prompt: `- 1行目は「subsystem: 要約」の形式とし、subsystem は変更したディレクトリやドライバの名前にする
+- 要約は英語の命令形で書き、末尾にピリオドを付けない
+- 本文では問題点、その影響、修正方法の順に説明し、「このパッチは」ではなく命令形で書く`,
+		Lang:         "en",
+		SubjectLimit: 75,
+		Wrap:         75,
+	},
+}
+
+func defaultStyle() string {
+	return os.Getenv("AUTOGCM_STYLE")
+}
+
+// loadStyleProfile returns the profile called name from the repository's
+// styles.yaml, falling back to the built-in profiles.
+func (g *CommitMessageGenerator) loadStyleProfile(name string) (StyleProfile, error) {
+	profiles := map[string]StyleProfile{}
+	for n, p := range builtinStyles {
+		profiles[n] = p
+	}
+
+	if g.repo != nil {
+		content, err := g.readProjectFile(styleFile)
+		if err != nil {
+			return StyleProfile{}, err
+		}
+		var file struct {
+			Styles map[string]StyleProfile `yaml:"styles"`
+		}
+		if err := yaml.Unmarshal([]byte(content), &file); err != nil {
+			return StyleProfile{}, fmt.Errorf("parsing %s: %w", styleFile, err)
+		}
+		for n, p := range file.Styles {
+			profiles[n] = p
+		}
+	}
+
+	profile, ok := profiles[name]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return StyleProfile{}, fmt.Errorf("unknown -style %q (want one of %s, or define it in %s)", name, strings.Join(names, ", "), styleFile)
+	}
+	return profile, nil
+}
+
+// applyStyleProfile sets the options the profile fixes, except those given
+// explicitly on the command line, and returns its addition to the system
+// prompt.
+func (o *Options) applyStyleProfile(name string, profile StyleProfile) string {
+	if profile.Conventional && !flagSet("conventional") {
+		o.Conventional = true
+	}
+	if profile.Gitmoji && !flagSet("gitmoji") {
+		o.Gitmoji = true
+	}
+	if profile.Lang != "" && !flagSet("lang") {
+		o.Lang = profile.Lang
+		if !flagSet("proofread-lang") {
+			o.ProofreadLang = profile.Lang
+		}
+	}
+	if profile.SubjectLimit > 0 && !flagSet("subject-limit") {
+		o.SubjectLimit = profile.SubjectLimit
+	}
+	if profile.Wrap > 0 && !flagSet("wrap") {
+		o.WrapColumn = profile.Wrap
+	}
+
+	prompt := strings.TrimSpace(profile.Prompt)
+	if prompt == "" {
+		return ""
+	}
+	return fmt.Sprintf(styleProfilePrompt, name) + prompt + "\n"
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const projectPrompt = `
+
+# プロジェクト
+
+%s
+スコープや用語はこのプロジェクトで使われているものに合わせること。
+`
+
+// languageExtensions maps source extensions to the language reported as
+// the primary one of the project.
+var languageExtensions = map[string]string{
+	".go": "Go", ".py": "Python", ".js": "JavaScript", ".jsx": "JavaScript", ".mjs": "JavaScript",
+	".ts": "TypeScript", ".tsx": "TypeScript", ".rs": "Rust", ".java": "Java", ".kt": "Kotlin",
+	".rb": "Ruby", ".php": "PHP", ".cs": "C#", ".c": "C", ".h": "C", ".cc": "C++", ".cpp": "C++",
+	".hpp": "C++", ".swift": "Swift", ".dart": "Dart", ".scala": "Scala", ".ex": "Elixir",
+	".exs": "Elixir", ".hs": "Haskell", ".lua": "Lua", ".sh": "Shell", ".vue": "Vue", ".svelte": "Svelte",
+}
+
+var (
+	goModule       = regexp.MustCompile(`(?m)^module\s+(\S+)`)
+	tomlPackageKey = regexp.MustCompile(`(?m)^name\s*=\s*"([^"]+)"`)
+)
+
+// projectManifests name the files whose package name identifies the
+// project, in the order they are tried.
+var projectManifests = []struct {
+	file  string
+	parse func(content string) string
+}{
+	{"go.mod", func(c string) string { return firstSubmatch(goModule, c) }},
+	{"package.json", func(c string) string {
+		var pkg struct{ Name string }
+		if json.Unmarshal([]byte(c), &pkg) != nil {
+			return ""
+		}
+		return pkg.Name
+	}},
+	{"Cargo.toml", func(c string) string { return firstSubmatch(tomlPackageKey, c) }},
+	{"pyproject.toml", func(c string) string { return firstSubmatch(tomlPackageKey, c) }},
+}
+
+func firstSubmatch(re *regexp.Regexp, s string) string {
+	if m := re.FindStringSubmatch(s); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// projectContext describes the repository name, the module or package
+// name and the primary language, for -project.
+func (g *CommitMessageGenerator) projectContext() (string, error) {
+	if g.repo == nil {
+		return "", nil
+	}
+
+	var lines []string
+	if name := g.repoName(); name != "" {
+		lines = append(lines, "リポジトリ: "+name)
+	}
+
+	for _, m := range projectManifests {
+		content, err := g.readProjectFile(m.file)
+		if err != nil {
+			return "", err
+		}
+		if name := m.parse(content); name != "" {
+			lines = append(lines, fmt.Sprintf("モジュール: %s（%s）", name, m.file))
+			break
+		}
+	}
+
+	files, err := g.projectFiles()
+	if err != nil {
+		return "", err
+	}
+	if language := primaryLanguage(files); language != "" {
+		lines = append(lines, "主な言語: "+language)
+	}
+
+	if len(lines) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf(projectPrompt, strings.Join(lines, "\n")), nil
+}
+
+// readProjectFile reads a file at the root of the worktree, or of HEAD in
+// a bare repository. A missing file reads as "".
+func (g *CommitMessageGenerator) readProjectFile(name string) (string, error) {
+	if g.worktree != nil {
+		f, err := g.worktree.Filesystem.Open(name)
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("opening %s: %w", name, err)
+		}
+		defer f.Close()
+		content, err := io.ReadAll(f)
+		if err != nil {
+			return "", fmt.Errorf("reading %s: %w", name, err)
+		}
+		return string(content), nil
+	}
+
+	tree, err := g.headTree()
+	if tree == nil || err != nil {
+		return "", err
+	}
+	file, err := tree.File(name)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("getting %s: %w", name, err)
+	}
+	content, err := file.Contents()
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %w", name, err)
+	}
+	return content, nil
+}
+
+// projectFiles lists the tracked files: those in the index, or in HEAD for
+// a bare repository or a sparse index.
+func (g *CommitMessageGenerator) projectFiles() ([]string, error) {
+	var files []string
+	if g.worktree != nil && !g.sparseIndex() {
+		entries, err := g.indexEntries()
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			files = append(files, e.Name)
+		}
+		return files, nil
+	}
+
+	tree, err := g.headTree()
+	if tree == nil || err != nil {
+		return nil, err
+	}
+	err = tree.Files().ForEach(func(f *object.File) error {
+		files = append(files, f.Name)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing files: %w", err)
+	}
+	return files, nil
+}
+
+// headTree returns the tree of HEAD, or nil before the first commit.
+func (g *CommitMessageGenerator) headTree() (*object.Tree, error) {
+	head, err := g.repo.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting HEAD: %w", err)
+	}
+	commit, err := g.repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("getting commit object: %w", err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("getting tree: %w", err)
+	}
+	return tree, nil
+}
+
+// primaryLanguage returns the language with the most source files, not
+// counting vendored and generated code.
+func primaryLanguage(files []string) string {
+	counts := map[string]int{}
+	for _, f := range files {
+		if strings.HasPrefix(f, "vendor/") || strings.Contains(f, "node_modules/") || strings.HasPrefix(f, "third_party/") {
+			continue
+		}
+		if language, ok := languageExtensions[strings.ToLower(path.Ext(f))]; ok {
+			counts[language]++
+		}
+	}
+
+	languages := make([]string, 0, len(counts))
+	for language := range counts {
+		languages = append(languages, language)
+	}
+	sort.Slice(languages, func(a, b int) bool {
+		if counts[languages[a]] != counts[languages[b]] {
+			return counts[languages[a]] > counts[languages[b]]
+		}
+		return languages[a] < languages[b]
+	})
+	if len(languages) == 0 {
+		return ""
+	}
+	return languages[0]
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Remote prompt updates are opt-in: both variables must be set.
+const promptURLEnv = "AUTOGCM_PROMPT_URL"              // URL of the signed prompt manifest
+const promptPublicKeyEnv = "AUTOGCM_PROMPT_PUBLIC_KEY" // Base64 ed25519 key the manifest must be signed with
+
+const systemPromptFileEnv = "AUTOGCM_SYSTEM_PROMPT_FILE" // Replaces the system prompt, like -system-prompt
+
+const embeddedPromptVersion = "embedded"
+
+// PromptManifest is a signed system prompt release. Signature is the
+// base64 ed25519 signature of Version + "\n" + Prompt.
+type PromptManifest struct {
+	Version   string `json:"version"`
+	Prompt    string `json:"prompt"`
+	Signature string `json:"signature"`
+}
+
+func (m *PromptManifest) verify(publicKey ed25519.PublicKey) error {
+	sig, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return fmt.Errorf("decoding signature: %w", err)
+	}
+	if !ed25519.Verify(publicKey, []byte(m.Version+"\n"+m.Prompt), sig) {
+		return errors.New("prompt manifest signature does not verify")
+	}
+	return nil
+}
+
+func promptPublicKey() (ed25519.PublicKey, error) {
+	encoded := os.Getenv(promptPublicKeyEnv)
+	if encoded == "" {
+		return nil, fmt.Errorf("%s is not set", promptPublicKeyEnv)
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%s is not a base64 ed25519 public key", promptPublicKeyEnv)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+func promptCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("locating cache directory: %w", err)
+	}
+	return filepath.Join(dir, "autogcm", "prompts"), nil
+}
+
+func promptPinPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("locating config directory: %w", err)
+	}
+	return filepath.Join(dir, "autogcm", "prompt-pin"), nil
+}
+
+// activePrompt returns the system prompt to use and its version: the pinned
+// version if any, otherwise the most recently updated cached release,
+// otherwise the embedded prompt. Cached releases are re-verified on every
+// load and ignored if they do not verify.
+func activePrompt() (string, string) {
+	pinned := pinnedPromptVersion()
+	if pinned == embeddedPromptVersion {
+		return systemPrompt, embeddedPromptVersion
+	}
+
+	publicKey, err := promptPublicKey()
+	if err != nil {
+		return systemPrompt, embeddedPromptVersion
+	}
+
+	manifests := cachedPrompts(publicKey)
+	for _, m := range manifests {
+		if pinned == "" || m.Version == pinned {
+			return m.Prompt, m.Version
+		}
+	}
+
+	return systemPrompt, embeddedPromptVersion
+}
+
+func defaultSystemPromptFile() string {
+	return os.Getenv(systemPromptFileEnv)
+}
+
+// loadSystemPrompt returns the system prompt and its version: the file
+// given with -system-prompt if any, otherwise the active prompt.
+func loadSystemPrompt(path string) (string, string, error) {
+	if path == "" {
+		prompt, version := activePrompt()
+		return prompt, version, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("reading system prompt: %w", err)
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return "", "", fmt.Errorf("system prompt %s is empty", path)
+	}
+	return string(data), "file " + path, nil
+}
+
+// cachedPrompts returns the verified cached releases, newest first.
+func cachedPrompts(publicKey ed25519.PublicKey) []*PromptManifest {
+	dir, err := promptCacheDir()
+	if err != nil {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	type cached struct {
+		manifest *PromptManifest
+		modTime  time.Time
+	}
+	var found []cached
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		var m PromptManifest
+		if json.Unmarshal(data, &m) != nil || m.verify(publicKey) != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		found = append(found, cached{manifest: &m, modTime: info.ModTime()})
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i].modTime.After(found[j].modTime) })
+
+	manifests := make([]*PromptManifest, len(found))
+	for i, c := range found {
+		manifests[i] = c.manifest
+	}
+	return manifests
+}
+
+func pinnedPromptVersion() string {
+	path, err := promptPinPath()
+	if err != nil {
+		return ""
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// updatePrompt downloads the manifest, verifies it and stores it in the
+// cache.
+func updatePrompt(ctx context.Context, client *http.Client) (*PromptManifest, error) {
+	url := os.Getenv(promptURLEnv)
+	if url == "" {
+		return nil, fmt.Errorf("%s is not set; remote prompt updates are disabled", promptURLEnv)
+	}
+	publicKey, err := promptPublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching prompt manifest: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching prompt manifest: unexpected status %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading prompt manifest: %w", err)
+	}
+
+	var m PromptManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("unmarshaling prompt manifest: %w", err)
+	}
+	if m.Version == "" || m.Version == embeddedPromptVersion || strings.ContainsAny(m.Version, `/\`) {
+		return nil, fmt.Errorf("prompt manifest has an invalid version %q", m.Version)
+	}
+	if err := m.verify(publicKey); err != nil {
+		return nil, err
+	}
+
+	dir, err := promptCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating prompt cache: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, m.Version+".json"), data, 0o644); err != nil {
+		return nil, fmt.Errorf("caching prompt: %w", err)
+	}
+
+	return &m, nil
+}
+
+// pinPrompt pins version ("embedded" for the built-in prompt), or removes
+// the pin when version is "none".
+func pinPrompt(version string) error {
+	path, err := promptPinPath()
+	if err != nil {
+		return err
+	}
+
+	if version == "none" {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("removing pin: %w", err)
+		}
+		return nil
+	}
+
+	if version != embeddedPromptVersion {
+		publicKey, err := promptPublicKey()
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, m := range cachedPrompts(publicKey) {
+			if m.Version == version {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("prompt version %s is not cached; run `autogcm prompt update` first", version)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("creating config directory: %w", err)
+	}
+	return os.WriteFile(path, []byte(version+"\n"), 0o644)
+}
+
+// runPromptCommand implements `autogcm prompt show|update|pin [version]`.
+func runPromptCommand(ctx context.Context, options Options, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("usage: autogcm prompt show|update|pin [version|embedded|none]")
+	}
+
+	switch args[0] {
+	case "show":
+		prompt, version, err := loadSystemPrompt(options.SystemPrompt)
+		if err != nil {
+			return err
+		}
+		if pinned := pinnedPromptVersion(); pinned != "" && options.SystemPrompt == "" {
+			fmt.Fprintf(os.Stderr, "Prompt version: %s (pinned)\n", version)
+		} else {
+			fmt.Fprintf(os.Stderr, "Prompt version: %s\n", version)
+		}
+		fmt.Fprint(out, prompt)
+		return nil
+	case "update":
+		m, err := updatePrompt(ctx, options.httpClient())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Fetched prompt version %s.\n", m.Version)
+		if pinned := pinnedPromptVersion(); pinned != "" && pinned != m.Version {
+			fmt.Fprintf(os.Stderr, "Version %s is pinned; run `autogcm prompt pin none` to use the update.\n", pinned)
+		}
+		return nil
+	case "pin":
+		version := ""
+		if len(args) > 1 {
+			version = args[1]
+		}
+		if version == "" {
+			_, version = activePrompt()
+		}
+		if err := pinPrompt(version); err != nil {
+			return err
+		}
+		if version == "none" {
+			fmt.Fprintln(os.Stderr, "Prompt pin removed.")
+		} else {
+			fmt.Fprintf(os.Stderr, "Pinned prompt version %s.\n", version)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown prompt command %q", args[0])
+	}
+}
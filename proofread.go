@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// typoDictionaries maps a language to common misspellings and their
+// corrections. They are applied locally before the model pass; languages
+// without a dictionary rely on the model alone.
+var typoDictionaries = map[string]map[string]string{
+	"en": {
+		"teh":           "the",
+		"recieve":       "receive",
+		"recieved":      "received",
+		"seperate":      "separate",
+		"occured":       "occurred",
+		"occurence":     "occurrence",
+		"dependancy":    "dependency",
+		"dependancies":  "dependencies",
+		"enviroment":    "environment",
+		"existant":      "existent",
+		"initalize":     "initialize",
+		"intialize":     "initialize",
+		"paramter":      "parameter",
+		"paramters":     "parameters",
+		"refered":       "referred",
+		"retreive":      "retrieve",
+		"succesful":     "successful",
+		"sucessfully":   "successfully",
+		"wich":          "which",
+		"lenght":        "length",
+		"adress":        "address",
+		"compatability": "compatibility",
+		"defualt":       "default",
+		"funtion":       "function",
+		"reponse":       "response",
+		"upate":         "update",
+	},
+	"ja": {
+		"デバック":     "デバッグ",
+		"メソット":     "メソッド",
+		"ヘッター":     "ヘッダー",
+		"キャシュ":     "キャッシュ",
+		"アルゴリスム":   "アルゴリズム",
+		"バリテーション":  "バリデーション",
+		"シュミレーション": "シミュレーション",
+		"デフォルド":    "デフォルト",
+		"見ずらい":     "見づらい",
+		"読みずらい":    "読みづらい",
+		"使いずらい":    "使いづらい",
+		"分かりずらい":   "分かりづらい",
+		"わかりずらい":   "わかりづらい",
+	},
+}
+
+const proofreadPrompt = `You proofread git commit messages written in %s.
+Fix spelling, typos and grammar only. Do not change the meaning, the
+structure, identifiers, file names or code in backticks, and do not add
+anything. Output only the corrected commit message.`
+
+// fixTypos applies the local typo dictionary for lang to message. ASCII
+// words are only replaced whole; other scripts, such as Japanese, have no
+// word boundaries and are replaced wherever they occur.
+func fixTypos(message string, lang string) string {
+	dict := typoDictionaries[lang]
+	for wrong, right := range dict {
+		if !isASCII(wrong) {
+			message = strings.ReplaceAll(message, wrong, right)
+			continue
+		}
+		pattern := regexp.MustCompile(`\b(?i:` + regexp.QuoteMeta(wrong) + `)\b`)
+		message = pattern.ReplaceAllStringFunc(message, func(match string) string {
+			if match[0] >= 'A' && match[0] <= 'Z' {
+				return strings.ToUpper(right[:1]) + right[1:]
+			}
+			return right
+		})
+	}
+	return message
+}
+
+// proofread runs the local dictionary and then a short model pass over the
+// message, using the provider that produced it. A failing model pass keeps
+// the locally corrected message.
+func (g *CommitMessageGenerator) proofread(ctx context.Context, result Result, lang string) string {
+	message := fixTypos(result.Message, lang)
+
+	p := g.registry.Lookup(result.Provider)
+	if p == nil {
+		return message
+	}
+
+	req := GenerateRequest{
+		System:   fmt.Sprintf(proofreadPrompt, languageName(lang)),
+		User:     message,
+		Sampling: g.options.Sampling,
+	}
+	if err := g.confirmFollowUp(p, req, "the message, to proofread it"); err != nil {
+		fmt.Fprintln(notices, "Not proofreading the message with the model.")
+		return message
+	}
+	fmt.Fprintln(notices, "Proofreading...")
+	resp, err := p.Generate(ctx, req)
+	if err != nil {
+		fmt.Fprintf(notices, "proofreading failed: %v\n", err)
+		return message
+	}
+	return cleanMessage(resp.Content)
+}
+
+var languageNames = map[string]string{
+	"en": "English",
+	"ja": "Japanese",
+	"de": "German",
+	"fr": "French",
+	"es": "Spanish",
+	"zh": "Chinese",
+	"ko": "Korean",
+}
+
+func languageName(lang string) string {
+	if name, ok := languageNames[lang]; ok {
+		return name
+	}
+	return lang
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// GenerateRequest is a single chat completion asked of a provider.
+type GenerateRequest struct {
+	System     string
+	User       string
+	Sampling   SamplingOptions
+	Structured bool // Ask for a StructuredMessage JSON object
+	N          int  // Number of alternative answers; 0 means one
+}
+
+// GenerateResponse is the provider's answer. Usage is nil when the
+// provider did not report token counts. On error, Content may hold the
+// partial answer streamed before the failure.
+type GenerateResponse struct {
+	Content      string
+	Alternatives []string // The other answers when more than one was asked for
+	Usage        *Usage
+}
+
+// Provider is a backend that can generate commit messages.
+type Provider interface {
+	Name() string
+	Model() string
+	// Available reports whether the provider is configured, e.g. has an
+	// API key.
+	Available() bool
+	Generate(ctx context.Context, req GenerateRequest) (GenerateResponse, error)
+}
+
+// Registry holds the known providers in fallback order.
+type Registry struct {
+	providers []Provider
+}
+
+// providerNames are the built-in providers in their default fallback order.
+var providerNames = []string{"local", "groq", "openai"}
+
+// newRegistry returns the providers in the -providers order, or the
+// default order when none is given. With -local-only, only providers on
+// this machine are kept.
+func newRegistry(options Options) *Registry {
+	all := &Registry{
+		providers: []Provider{
+			newLocalProvider(options),
+			newGroqProvider(options),
+			newOpenAIProvider(options),
+		},
+	}
+	r := all
+	if len(options.Providers) > 0 {
+		r = &Registry{}
+		for _, name := range options.Providers {
+			if p := all.Lookup(name); p != nil {
+				r.providers = append(r.providers, p)
+			}
+		}
+	}
+	if !options.LocalOnly {
+		return r
+	}
+	local := &Registry{}
+	for _, p := range r.providers {
+		if isLocal(p) {
+			local.providers = append(local.providers, p)
+		}
+	}
+	return local
+}
+
+// checkProviders rejects unknown -providers and -model names.
+func checkProviders(options Options) error {
+	known := func(name string) bool {
+		for _, n := range providerNames {
+			if n == name {
+				return true
+			}
+		}
+		return false
+	}
+	for _, name := range options.Providers {
+		if !known(name) {
+			return fmt.Errorf("unknown provider %q in -providers (want %s)", name, strings.Join(providerNames, ", "))
+		}
+	}
+	for name := range options.Models {
+		if !known(name) {
+			return fmt.Errorf("unknown provider %q in -model (want %s)", name, strings.Join(providerNames, ", "))
+		}
+	}
+	return nil
+}
+
+// modelFor returns the -model override for a provider, or model.
+func (o Options) modelFor(provider string, model string) string {
+	if m := o.Models[provider]; m != "" {
+		return m
+	}
+	return model
+}
+
+// Available returns the configured providers in fallback order.
+func (r *Registry) Available() []Provider {
+	var available []Provider
+	for _, p := range r.providers {
+		if p.Available() {
+			available = append(available, p)
+		}
+	}
+	return available
+}
+
+// First returns the provider a request would go to: the first configured
+// one, or the first one at all when none is configured.
+func (r *Registry) First() Provider {
+	if available := r.Available(); len(available) > 0 {
+		return available[0]
+	}
+	return r.providers[0]
+}
+
+// Lookup returns the provider called name, or nil.
+func (r *Registry) Lookup(name string) Provider {
+	for _, p := range r.providers {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package main
+
+// newGroqProvider returns the Groq backend, which serves the OpenAI chat
+// completions API. It does not support json_schema response formats.
+func newGroqProvider(options Options) Provider {
+	return &openAICompatibleProvider{
+		name:     "groq",
+		url:      "https://api.groq.com/openai/v1/chat/completions",
+		model:    options.modelFor("groq", "llama3-70b-8192"),
+		apiKey:   newCredential("GROQ_API_KEY", "groq"),
+		client:   options.httpClient(),
+		retries:  options.RetryAttempts,
+		progress: clearingWriter{notices},
+		audit:    newAuditLog(options.AuditLog),
+	}
+}
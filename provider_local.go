@@ -0,0 +1,30 @@
+package main
+
+import "strings"
+
+// newLocalProvider returns an OpenAI-compatible server on the user's own
+// machine or network, such as Ollama (http://localhost:11434/v1) or LM
+// Studio (http://localhost:1234/v1), given with -local-url. It needs a
+// model (-model local=NAME), but no API key unless LOCAL_API_KEY is set.
+func newLocalProvider(options Options) Provider {
+	return &openAICompatibleProvider{
+		name:     "local",
+		url:      chatCompletionsURL(options.LocalURL),
+		model:    options.modelFor("local", ""),
+		apiKey:   newCredential("LOCAL_API_KEY", "local"),
+		keyless:  true,
+		client:   options.httpClient(),
+		retries:  options.RetryAttempts,
+		progress: clearingWriter{notices},
+		audit:    newAuditLog(options.AuditLog),
+	}
+}
+
+// chatCompletionsURL accepts either a server's base URL or its full chat
+// completions endpoint.
+func chatCompletionsURL(base string) string {
+	if base == "" || strings.HasSuffix(base, "/chat/completions") {
+		return base
+	}
+	return strings.TrimSuffix(base, "/") + "/chat/completions"
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type OpenAIRequest struct {
+	Model       string    `json:"model"`
+	Messages    []Message `json:"messages"`
+	Stream      bool      `json:"stream,omitempty"`
+	Temperature *float64  `json:"temperature,omitempty"`
+	TopP        *float64  `json:"top_p,omitempty"`
+	MaxTokens   int       `json:"max_tokens,omitempty"`
+	N           int       `json:"n,omitempty"`
+	Seed        *int      `json:"seed,omitempty"`
+
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+}
+
+type OpenAIStreamChunk struct {
+	Choices []struct {
+		Index int `json:"index"`
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+	XGroq *struct {
+		Usage *Usage `json:"usage"`
+	} `json:"x_groq"`
+}
+
+// openAICompatibleProvider talks to any endpoint implementing the OpenAI
+// chat completions API.
+type openAICompatibleProvider struct {
+	name       string
+	url        string
+	model      string
+	apiKey     *credential
+	jsonSchema bool // Supports response_format json_schema
+	choices    bool // Supports n > 1
+	keyless    bool // Needs no API key, like most local servers
+	client     *http.Client
+	retries    int
+	progress   io.Writer
+	audit      *auditLog
+}
+
+func newOpenAIProvider(options Options) Provider {
+	return &openAICompatibleProvider{
+		name:       "openai",
+		url:        "https://api.openai.com/v1/chat/completions",
+		model:      options.modelFor("openai", "gpt-4o-mini-2024-07-18"),
+		apiKey:     newCredential("OPENAI_API_KEY", "openai"),
+		jsonSchema: true,
+		choices:    true,
+		client:     options.httpClient(),
+		retries:    options.RetryAttempts,
+		progress:   clearingWriter{notices},
+		audit:      newAuditLog(options.AuditLog),
+	}
+}
+
+func (p *openAICompatibleProvider) Name() string     { return p.name }
+func (p *openAICompatibleProvider) Model() string    { return p.model }
+func (p *openAICompatibleProvider) Endpoint() string { return p.url }
+
+func (p *openAICompatibleProvider) Available() bool {
+	if p.keyless {
+		return p.url != "" && p.model != ""
+	}
+	return p.apiKey.Configured()
+}
+
+func (p *openAICompatibleProvider) ConfigHint() string {
+	if p.keyless {
+		return "set -local-url to the server's base URL and -model " + p.name + "=MODEL"
+	}
+	return p.apiKey.Hint()
+}
+
+// key returns the API key, or "" for a keyless provider without one.
+func (p *openAICompatibleProvider) key() (string, error) {
+	if p.keyless && !p.apiKey.Configured() {
+		return "", nil
+	}
+	return p.apiKey.Get()
+}
+
+// authorize sets the request's API key, if there is one.
+func authorize(req *http.Request, apiKey string) {
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+}
+
+// Ping lists the endpoint's models, which checks both reachability and the
+// API key.
+func (p *openAICompatibleProvider) Ping(ctx context.Context) error {
+	apiKey, err := p.key()
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(p.url, "/chat/completions") + "/models"
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	authorize(req, apiKey)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("API key rejected (%s); check %s", resp.Status, p.apiKey.env)
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("unexpected status %s from %s", resp.Status, url)
+	}
+	return nil
+}
+
+func (p *openAICompatibleProvider) Generate(ctx context.Context, req GenerateRequest) (GenerateResponse, error) {
+	apiKey, err := p.key()
+	if err != nil {
+		return GenerateResponse{}, err
+	}
+	if req.N > 1 && !p.choices {
+		return p.generateEach(ctx, req)
+	}
+
+	id, err := p.audit.request(p, req)
+	if err != nil {
+		return GenerateResponse{}, err
+	}
+	resp, err := p.send(ctx, apiKey, req)
+	p.audit.response(id, p, resp, err)
+	return resp, err
+}
+
+// send makes a single chat completions request.
+func (p *openAICompatibleProvider) send(ctx context.Context, apiKey string, req GenerateRequest) (GenerateResponse, error) {
+	requestBody := OpenAIRequest{
+		Model: p.model,
+		Messages: []Message{
+			{Role: "system", Content: req.System},
+			{Role: "user", Content: req.User},
+		},
+		Stream: true,
+	}
+	if req.N > 1 {
+		requestBody.N = req.N
+	}
+	req.Sampling.apply(&requestBody)
+	if req.Structured {
+		requestBody.ResponseFormat = responseFormat(p.jsonSchema)
+	}
+
+	jsonBody, err := json.Marshal(requestBody)
+	if err != nil {
+		return GenerateResponse{}, fmt.Errorf("marshaling request body: %w", err)
+	}
+
+	resp, err := doWithRetry(ctx, p.client, p.retries, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", p.url, bytes.NewReader(jsonBody))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "text/event-stream")
+		authorize(req, apiKey)
+		return req, nil
+	})
+	if err != nil {
+		return GenerateResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return GenerateResponse{}, fmt.Errorf("unexpected status %s. Full response: %s", resp.Status, string(body))
+	}
+
+	choices, usage, err := readStream(resp.Body, p.progress)
+	if err != nil {
+		return GenerateResponse{Content: choices[0]}, err
+	}
+
+	return GenerateResponse{Content: choices[0], Alternatives: choices[1:], Usage: usage}, nil
+}
+
+// generateEach asks for req.N answers one request at a time, for endpoints
+// that only return a single choice.
+func (p *openAICompatibleProvider) generateEach(ctx context.Context, req GenerateRequest) (GenerateResponse, error) {
+	n := req.N
+	req.N = 0
+
+	var resp GenerateResponse
+	for i := 0; i < n; i++ {
+		one, err := p.Generate(ctx, req)
+		if err != nil {
+			if i == 0 {
+				return one, err
+			}
+			break // Keep the answers we already have
+		}
+		if i == 0 {
+			resp = one
+			continue
+		}
+		resp.Alternatives = append(resp.Alternatives, one.Content)
+		if resp.Usage != nil && one.Usage != nil {
+			resp.Usage.PromptTokens += one.Usage.PromptTokens
+			resp.Usage.CompletionTokens += one.Usage.CompletionTokens
+		} else {
+			resp.Usage = nil
+		}
+	}
+	return resp, nil
+}
+
+// apply copies the configured parameters onto req.
+func (s SamplingOptions) apply(req *OpenAIRequest) {
+	if s.Temperature >= 0 {
+		req.Temperature = &s.Temperature
+	}
+	if s.TopP >= 0 {
+		req.TopP = &s.TopP
+	}
+	req.MaxTokens = s.MaxTokens
+	if s.Seed != 0 {
+		req.Seed = &s.Seed
+	}
+}
+
+// readStream consumes a server-sent events body in the OpenAI chat
+// completion format, echoing each content delta of the first choice to
+// progress as it arrives. It returns the content of every choice, the
+// first choice first, so the result always has at least one element.
+// When the stream breaks off, the content received so far is returned
+// along with the error.
+func readStream(body io.Reader, progress io.Writer) ([]string, *Usage, error) {
+	var contents []strings.Builder
+	var usage *Usage
+	defer fmt.Fprintln(progress)
+
+	received := func() []string {
+		choices := []string{""}
+		for i := range contents {
+			if i == 0 {
+				choices[0] = contents[0].String()
+			} else if contents[i].Len() > 0 {
+				choices = append(choices, contents[i].String())
+			}
+		}
+		return choices
+	}
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk OpenAIStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return []string{""}, nil, fmt.Errorf("unmarshaling stream chunk: %w", err)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		} else if chunk.XGroq != nil && chunk.XGroq.Usage != nil {
+			usage = chunk.XGroq.Usage
+		}
+
+		for _, choice := range chunk.Choices {
+			for len(contents) <= choice.Index {
+				contents = append(contents, strings.Builder{})
+			}
+			contents[choice.Index].WriteString(choice.Delta.Content)
+			if choice.Index == 0 {
+				fmt.Fprint(progress, choice.Delta.Content)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return received(), nil, fmt.Errorf("reading response stream: %w", err)
+	}
+
+	choices := received()
+	if choices[0] == "" {
+		return choices, nil, fmt.Errorf("no content in response stream")
+	}
+
+	return choices, usage, nil
+}
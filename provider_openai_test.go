@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAICompatibleProviderAuthorization(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		keyless bool
+		want    string
+	}{
+		{"with a key", "sk-test", false, "Bearer sk-test"},
+		{"keyless without a key", "", true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = append(got, r.Header.Get("Authorization"))
+				if r.Method == "POST" {
+					w.Header().Set("Content-Type", "text/event-stream")
+					io.WriteString(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"fix: typo\"}}]}\n\ndata: [DONE]\n\n")
+				}
+			}))
+			defer server.Close()
+
+			t.Setenv("AUTOGCM_TEST_API_KEY", tt.key)
+			p := &openAICompatibleProvider{
+				name:     "test",
+				url:      server.URL + "/v1/chat/completions",
+				model:    "m",
+				apiKey:   newCredential("AUTOGCM_TEST_API_KEY", "test"),
+				keyless:  tt.keyless,
+				client:   server.Client(),
+				progress: io.Discard,
+			}
+
+			if err := p.Ping(context.Background()); err != nil {
+				t.Fatalf("Ping: %v", err)
+			}
+			resp, err := p.Generate(context.Background(), GenerateRequest{System: "s", User: "u"})
+			if err != nil {
+				t.Fatalf("Generate: %v", err)
+			}
+			if resp.Content != "fix: typo" {
+				t.Errorf("Generate returned %q", resp.Content)
+			}
+			if len(got) != 2 || got[0] != tt.want || got[1] != tt.want {
+				t.Errorf("Authorization headers %q, want %q for both requests", got, tt.want)
+			}
+		})
+	}
+}
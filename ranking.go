@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Relevance ranks, most relevant first. When the diff does not fit the
+// budget, files are included in this order and the rest are only listed.
+const (
+	rankSource = iota
+	rankTest
+	rankDocs
+	rankConfig
+	rankGenerated
+)
+
+var testPattern = regexp.MustCompile(`(^|/)(tests?|__tests__|spec)/|_test\.go$|\.(test|spec)\.[jt]sx?$|(^|/)test_[^/]*\.py$|_test\.py$|Test\.(java|kt)$`)
+
+var docExtensions = map[string]bool{".md": true, ".rst": true, ".txt": true, ".adoc": true}
+
+var configExtensions = map[string]bool{
+	".json": true, ".yaml": true, ".yml": true, ".toml": true, ".ini": true,
+	".cfg": true, ".conf": true, ".xml": true, ".properties": true, ".env": true,
+}
+
+var configFiles = map[string]bool{
+	"Makefile": true, "Dockerfile": true, "go.mod": true, "package.json": true,
+	".gitignore": true, ".gitattributes": true, ".gitmodules": true, ".editorconfig": true,
+}
+
+// relevanceRank classifies a patch as source, test, docs, config or
+// generated code.
+func relevanceRank(p FilePatch) int {
+	name := path.Base(p.Path)
+	ext := strings.ToLower(path.Ext(p.Path))
+	switch {
+	case strings.HasPrefix(p.Patch, "Generated file: ") || strings.HasPrefix(p.Patch, "Lockfile "):
+		return rankGenerated
+	case testPattern.MatchString(p.Path):
+		return rankTest
+	case docExtensions[ext] || strings.HasPrefix(p.Path, "docs/") || strings.HasPrefix(name, "README") || strings.HasPrefix(name, "CHANGELOG"):
+		return rankDocs
+	case configExtensions[ext] || configFiles[name] || strings.HasPrefix(p.Path, ".github/"):
+		return rankConfig
+	}
+	return rankSource
+}
+
+// diffstat returns the number of added and removed lines in a patch.
+func diffstat(patch string) (int, int) {
+	var added, removed int
+	for _, line := range strings.Split(patch, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++ ") || strings.HasPrefix(line, "--- "):
+		case strings.HasPrefix(line, "+"):
+			added++
+		case strings.HasPrefix(line, "-"):
+			removed++
+		}
+	}
+	return added, removed
+}
+
+// diffstatLine lists a file whose diff did not fit, like `git diff --stat`.
+func diffstatLine(p FilePatch) string {
+	added, removed := diffstat(p.Patch)
+	return fmt.Sprintf(" %s | +%d -%d\n", p.Path, added, removed)
+}
+
+const omittedHeader = "\nOther changed files (diff omitted to fit the context):\n"
+
+const summaryDirDepth = 2 // Path components that name a directory in the summary
+
+// diffstatSummary describes the whole change as `git diff --stat` would,
+// for diffs so large that not even a line per file fits the budget: the
+// totals, then per-directory totals, then as many files as fit.
+func diffstatSummary(patches []FilePatch, budget int, counter *TokenCounter) string {
+	type stat struct {
+		name           string
+		files          int
+		added, removed int
+	}
+	var total stat
+	dirs := map[string]*stat{}
+	files := make([]stat, 0, len(patches))
+	for _, p := range patches {
+		added, removed := diffstat(p.Patch)
+		total.files++
+		total.added += added
+		total.removed += removed
+		files = append(files, stat{name: p.Path, files: 1, added: added, removed: removed})
+
+		dir := path.Dir(p.Path)
+		if parts := strings.Split(dir, "/"); len(parts) > summaryDirDepth {
+			dir = strings.Join(parts[:summaryDirDepth], "/")
+		}
+		if dirs[dir] == nil {
+			dirs[dir] = &stat{name: dir}
+		}
+		dirs[dir].files++
+		dirs[dir].added += added
+		dirs[dir].removed += removed
+	}
+
+	byChurn := func(list []stat) {
+		sort.SliceStable(list, func(a, b int) bool {
+			return list[a].added+list[a].removed > list[b].added+list[b].removed
+		})
+	}
+	var dirList []stat
+	for _, d := range dirs {
+		dirList = append(dirList, *d)
+	}
+	sort.Slice(dirList, func(a, b int) bool { return dirList[a].name < dirList[b].name })
+	byChurn(dirList)
+	byChurn(files)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Diff too large to include; summary of the changes:\n %d files changed, %d insertions(+), %d deletions(-)\n", total.files, total.added, total.removed)
+	used := counter.Count(b.String())
+
+	// appendLines writes lines while they fit, then a count of the rest.
+	const moreCost = 8 // Tokens kept for the " ... and N more" line
+	appendLines := func(title string, list []stat, line func(stat) string) {
+		if used+counter.Count(title) > budget {
+			return
+		}
+		b.WriteString(title)
+		used += counter.Count(title)
+		for i, s := range list {
+			text := line(s)
+			cost := counter.Count(text)
+			if used+cost > budget-moreCost {
+				fmt.Fprintf(&b, " ... and %d more\n", len(list)-i)
+				used += moreCost
+				return
+			}
+			b.WriteString(text)
+			used += cost
+		}
+	}
+	appendLines("\nBy directory:\n", dirList, func(s stat) string {
+		return fmt.Sprintf(" %s/ | %d files +%d -%d\n", s.name, s.files, s.added, s.removed)
+	})
+	appendLines("\nFiles with the most changes:\n", files, func(s stat) string {
+		return fmt.Sprintf(" %s | +%d -%d\n", s.name, s.added, s.removed)
+	})
+
+	return b.String()
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// privateKeyBlock matches a PEM private key up to its END line, or to the
+// end of the patch when the key is cut off.
+var privateKeyBlock = regexp.MustCompile(`(?s)(-----BEGIN [A-Z ]*PRIVATE KEY-----)(.*?)(-----END [A-Z ]*PRIVATE KEY-----|\z)`)
+
+// credentialValue matches the quoted value of an assignment to a
+// credential-like name, as the "generic credential" secret pattern does.
+var credentialValue = regexp.MustCompile(`(?i)(\b(?:password|passwd|secret|api[_-]?key|token)\b\s*[:=]\s*["'])([^"'\s]{8,})(["'])`)
+
+var entropyCandidate = regexp.MustCompile(`[A-Za-z0-9+/_=-]{32,}`)
+
+const minSecretEntropy = 4.3 // Bits per character; random base64 is close to 6
+
+// redactSecrets replaces likely secrets in patches with placeholders, so
+// that an accidentally staged credential never reaches a provider, and
+// warns about every file it changed.
+func redactSecrets(patches []FilePatch, w io.Writer) []FilePatch {
+	redacted := make([]FilePatch, len(patches))
+	for i, p := range patches {
+		var found []string
+		p.Patch, found = redactPatch(p.Patch)
+		if len(found) > 0 {
+			fmt.Fprintf(w, "Warning: redacted a possible %s in %s before sending\n", strings.Join(found, ", "), p.Path)
+		}
+		redacted[i] = p
+	}
+	return redacted
+}
+
+// redactPatch returns patch with private key bodies, known token formats,
+// quoted credential values and high-entropy strings replaced, and the
+// kinds of secret it found.
+func redactPatch(patch string) (string, []string) {
+	var found []string
+	note := func(name string) {
+		for _, f := range found {
+			if f == name {
+				return
+			}
+		}
+		found = append(found, name)
+	}
+
+	patch = privateKeyBlock.ReplaceAllStringFunc(patch, func(block string) string {
+		note("private key")
+		m := privateKeyBlock.FindStringSubmatch(block)
+		lines := strings.Split(m[2], "\n")
+		last := len(lines)
+		if m[3] != "" {
+			last-- // Only the diff prefix of the END line
+		}
+		// The first element is the rest of the BEGIN line. Keep the diff
+		// prefix of every line so the hunk still reads as one.
+		for j := 1; j < last; j++ {
+			if lines[j] == "" {
+				continue
+			}
+			prefix := ""
+			if strings.ContainsAny(lines[j][:1], "+- ") {
+				prefix = lines[j][:1]
+			}
+			lines[j] = prefix + "[REDACTED private key]"
+		}
+		return m[1] + strings.Join(lines, "\n") + m[3]
+	})
+
+	for _, name := range sortedKeys(secretPatterns) {
+		if name == "private key" || name == "generic credential" {
+			continue
+		}
+		pattern := secretPatterns[name]
+		if pattern.MatchString(patch) {
+			note(name)
+			patch = pattern.ReplaceAllString(patch, "[REDACTED "+name+"]")
+		}
+	}
+
+	if credentialValue.MatchString(patch) {
+		note("credential")
+		patch = credentialValue.ReplaceAllString(patch, "${1}[REDACTED credential]${3}")
+	}
+
+	patch = entropyCandidate.ReplaceAllStringFunc(patch, func(s string) string {
+		if !looksRandom(s) {
+			return s
+		}
+		note("high-entropy string")
+		return "[REDACTED high-entropy string]"
+	})
+
+	return patch, found
+}
+
+// identifierPart matches the words an identifier is made of: a
+// capitalized or lower-case word, an acronym or a number.
+var identifierPart = regexp.MustCompile(`[A-Z]?[a-z]+|[A-Z]+|[0-9]+`)
+
+const minIdentifierPart = 3.5 // Average characters per word of an identifier; random base64 switches class every two or so
+
+// looksRandom reports whether s mixes upper case, lower case and digits
+// throughout, with the entropy of a generated key, rather than being an
+// identifier such as ErrUnsupportedSHA256Checksum or MAX_RETRY_V2, or a
+// hex hash.
+func looksRandom(s string) bool {
+	var upper, lower, digit bool
+	counts := map[rune]int{}
+	for _, r := range s {
+		counts[r]++
+		switch {
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= '0' && r <= '9':
+			digit = true
+		}
+	}
+	if !upper || !lower || !digit {
+		return false
+	}
+	if parts := identifierPart.FindAllString(s, -1); float64(len(s))/float64(len(parts)) >= minIdentifierPart {
+		return false
+	}
+	entropy := 0.0
+	for _, n := range counts {
+		p := float64(n) / float64(len(s))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy >= minSecretEntropy
+}
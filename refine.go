@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const lastMessageFile = "autogcm-last-message" // Stored in the git directory
+
+const refinePrompt = `
+
+# 修正
+
+前回は次のコミットメッセージを生成した。
+
+` + "```" + `
+%s
+` + "```" + `
+
+一から書き直すのではなく、次の指示に従ってこのメッセージを修正したものを出力すること。指示と関係のない部分はできるだけそのまま残すこと。
+
+指示: %s
+`
+
+// refineContext asks the model to revise previous as instructed.
+func refineContext(previous string, instruction string) string {
+	return fmt.Sprintf(refinePrompt, strings.TrimSpace(previous), strings.TrimSpace(instruction))
+}
+
+// refineMessages sends the diff again together with the previous message
+// and the user's instruction, so the model revises rather than starts over.
+func (g *CommitMessageGenerator) refineMessages(ctx context.Context, patches []FilePatch, meta RepoMetadata, previous string, instruction string) (Result, []string, error) {
+	g.refinement = refineContext(previous, instruction)
+	defer func() { g.refinement = "" }()
+	return g.generateMessages(ctx, patches, meta)
+}
+
+func (g *CommitMessageGenerator) lastMessagePath() string {
+	dir := g.gitDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, lastMessageFile)
+}
+
+// loadLastMessage returns the message printed by the previous run, or "".
+func (g *CommitMessageGenerator) loadLastMessage() string {
+	path := g.lastMessagePath()
+	if path == "" {
+		return ""
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// saveLastMessage remembers message for a later -refine.
+func (g *CommitMessageGenerator) saveLastMessage(message string) error {
+	path := g.lastMessagePath()
+	if path == "" {
+		return nil
+	}
+	return os.WriteFile(path, []byte(message), 0o644)
+}
+
+// rememberMessage saves message for -refine, warning when it cannot.
+func (g *CommitMessageGenerator) rememberMessage(message string) {
+	if err := g.saveLastMessage(message); err != nil {
+		fmt.Fprintf(notices, "Warning: could not remember the message for -refine: %v\n", err)
+	}
+}
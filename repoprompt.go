@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const repoPromptFile = ".autogcm/prompt.md" // Committed with the repository
+
+const repoPromptHeader = `
+
+# このリポジトリについて
+
+以下はこのリポジトリの利用者が用意した補足情報である。用語や書き方はこれに従うこと。
+
+`
+
+// repoPromptContext returns the project's own additions to the system
+// prompt: the contents of .autogcm/prompt.md and the autogcm.prompt key of
+// the repository's git config.
+func (g *CommitMessageGenerator) repoPromptContext() (string, error) {
+	if g.repo == nil {
+		return "", nil
+	}
+
+	var parts []string
+	content, err := g.readProjectFile(repoPromptFile)
+	if err != nil {
+		return "", err
+	}
+	if content = strings.TrimSpace(content); content != "" {
+		parts = append(parts, content)
+	}
+
+	cfg, err := g.repo.Config()
+	if err != nil {
+		return "", fmt.Errorf("reading git config: %w", err)
+	}
+	if extra := strings.TrimSpace(cfg.Raw.Section("autogcm").Option("prompt")); extra != "" {
+		parts = append(parts, extra)
+	}
+
+	if len(parts) == 0 {
+		return "", nil
+	}
+	return repoPromptHeader + strings.Join(parts, "\n\n") + "\n", nil
+}
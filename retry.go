@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const retryBaseDelay = 500 * time.Millisecond
+const retryMaxDelay = 8 * time.Second
+const maxRateLimitWait = 10 * time.Second // Longest Retry-After we are willing to sleep through
+
+// RateLimitError is returned when a provider keeps answering 429 or asks us
+// to wait longer than maxRateLimitWait.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("rate limited by provider (retry after %s)", e.RetryAfter.Round(time.Second))
+	}
+	return "rate limited by provider"
+}
+
+// doWithRetry sends the request built by newRequest, retrying on 5xx
+// responses, timeouts and connection resets with jittered exponential
+// backoff. A fresh request is built for every attempt so the body can be
+// replayed.
+func doWithRetry(ctx context.Context, client *http.Client, attempts int, newRequest func(ctx context.Context) (*http.Request, error)) (*http.Response, error) {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var lastErr error
+	rateLimitRetried := false
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			delay := backoffDelay(attempt)
+			debugf("retrying in %s (attempt %d of %d)", delay.Round(time.Millisecond), attempt+1, attempts)
+			if err := sleepContext(ctx, delay); err != nil {
+				return nil, err
+			}
+		}
+
+		req, err := newRequest(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("creating request: %w", err)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			debugf("%s %s: %v", req.Method, req.URL, err)
+			if ctx.Err() != nil || !isTransientError(err) {
+				return nil, fmt.Errorf("sending request: %w", err)
+			}
+			lastErr = fmt.Errorf("sending request: %w", err)
+			continue
+		}
+		debugf("%s %s: %s", req.Method, req.URL, resp.Status)
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+
+			wait := rateLimitDelay(resp.Header)
+			if rateLimitRetried || wait > maxRateLimitWait {
+				return nil, &RateLimitError{RetryAfter: wait}
+			}
+			rateLimitRetried = true
+			debugf("rate limited; waiting %s", wait.Round(time.Millisecond))
+			if err := sleepContext(ctx, wait); err != nil {
+				return nil, err
+			}
+			attempt--
+			continue
+		}
+
+		if resp.StatusCode >= 500 {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			lastErr = fmt.Errorf("unexpected status %s. Full response: %s", resp.Status, string(body))
+			continue
+		}
+
+		return resp, nil
+	}
+
+	return nil, fmt.Errorf("giving up after %d attempts: %w", attempts, lastErr)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// backoffDelay returns a random delay in [0, base*2^attempt), capped at
+// retryMaxDelay ("full jitter").
+func backoffDelay(attempt int) time.Duration {
+	limit := retryBaseDelay << (attempt - 1)
+	if limit <= 0 || limit > retryMaxDelay {
+		limit = retryMaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(limit)))
+}
+
+// rateLimitDelay reads how long a 429 response asks us to wait, from
+// Retry-After (seconds or HTTP date) or the OpenAI/Groq style
+// x-ratelimit-reset-* headers ("1s", "6m0s", "350ms").
+func rateLimitDelay(header http.Header) time.Duration {
+	if v := header.Get("Retry-After"); v != "" {
+		if seconds, err := strconv.ParseFloat(v, 64); err == nil {
+			return time.Duration(seconds * float64(time.Second))
+		}
+		if at, err := http.ParseTime(v); err == nil {
+			return time.Until(at)
+		}
+	}
+
+	var wait time.Duration
+	for _, key := range []string{"X-Ratelimit-Reset-Requests", "X-Ratelimit-Reset-Tokens"} {
+		if d, err := time.ParseDuration(header.Get(key)); err == nil && d > wait {
+			wait = d
+		}
+	}
+	if wait == 0 {
+		wait = retryBaseDelay
+	}
+	return wait
+}
+
+func isTransientError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
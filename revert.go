@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+const maxRevertExamples = 3    // Earlier revert messages shown as style examples
+const revertHistoryDepth = 500 // Commits searched for those examples
+
+const revertPrompt = `
+
+# リバート
+
+これは以下のコミットを取り消すコミットである。入力データは取り消しの差分である。何を取り消すのか、元のコミットの内容を踏まえて記述すること。
+
+取り消すコミット %s:
+
+%s
+`
+
+const revertExamplesPrompt = `
+このリポジトリの過去のリバートコミットのメッセージは次の通り。同じ形式に従うこと。
+`
+
+// revertTarget returns the commit being reverted by an in-progress
+// `git revert` (REVERT_HEAD), or nil when there is none.
+func (g *CommitMessageGenerator) revertTarget() (*object.Commit, error) {
+	dir := g.gitDir()
+	if dir == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "REVERT_HEAD"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading REVERT_HEAD: %w", err)
+	}
+
+	return g.resolveCommit(strings.TrimSpace(string(data)))
+}
+
+// revertContext describes the reverted commit and, when the repository
+// has reverted commits before, shows those messages as the style to use.
+func (g *CommitMessageGenerator) revertContext(reverted *object.Commit) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, revertPrompt, reverted.Hash, strings.TrimSpace(reverted.Message))
+
+	if examples := g.revertExamples(); len(examples) > 0 {
+		b.WriteString(revertExamplesPrompt)
+		for _, example := range examples {
+			fmt.Fprintf(&b, "\n```\n%s\n```\n", example)
+		}
+	}
+
+	return b.String()
+}
+
+// revertExamples returns the messages of recent revert commits. Failing
+// to read history only means there are no examples.
+func (g *CommitMessageGenerator) revertExamples() []string {
+	head := g.headCommit()
+	if head == nil {
+		return nil
+	}
+	commits := walkHistory(g.repo, head, nil)
+	defer commits.Close()
+
+	var examples []string
+	seen := 0
+	_ = commits.ForEach(func(c *object.Commit) error {
+		if seen == revertHistoryDepth || len(examples) == maxRevertExamples {
+			return storer.ErrStop
+		}
+		seen++
+		if strings.Contains(c.Message, "This reverts commit ") || strings.HasPrefix(c.Message, "Revert ") {
+			examples = append(examples, strings.TrimSpace(c.Message))
+		}
+		return nil
+	})
+
+	return examples
+}
+
+// ensureRevertReference appends git's "This reverts commit" line when the
+// message does not mention the reverted commit, so tools that look for it
+// keep working.
+func ensureRevertReference(message string, reverted plumbing.Hash) string {
+	if strings.Contains(message, reverted.String()) || strings.Contains(message, reverted.String()[:7]) {
+		return message
+	}
+	return fmt.Sprintf("%s\n\nThis reverts commit %s.", strings.TrimRight(message, "\n"), reverted)
+}
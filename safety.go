@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+)
+
+// secretPatterns matches credentials that should never be committed.
+var secretPatterns = map[string]*regexp.Regexp{
+	"AWS access key":     regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`),
+	"private key":        regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`),
+	"GitHub token":       regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`),
+	"Slack token":        regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}\b`),
+	"OpenAI API key":     regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}\b`),
+	"Groq API key":       regexp.MustCompile(`\bgsk_[A-Za-z0-9]{20,}\b`),
+	"Google API key":     regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`),
+	"generic credential": regexp.MustCompile(`(?i)\b(password|passwd|secret|api[_-]?key|token)\b\s*[:=]\s*["'][^"'\s]{8,}["']`),
+}
+
+var conflictMarker = regexp.MustCompile(`(?m)^(<{7}|={7}|>{7})( |$)`)
+
+// CheckOptions configures the staged-content safety checks.
+type CheckOptions struct {
+	ConflictMarkers bool
+	MaxFileSize     int64
+	Secrets         bool
+}
+
+// CheckFailure is a single problem found in a staged file.
+type CheckFailure struct {
+	Path   string
+	Reason string
+}
+
+// runSafetyChecks inspects every staged file and returns the problems found.
+func (g *CommitMessageGenerator) runSafetyChecks(opts CheckOptions) ([]CheckFailure, error) {
+	changes, err := g.changes()
+	if err != nil {
+		return nil, err
+	}
+
+	var failures []CheckFailure
+	for _, change := range changes {
+		if change.Action == git.Deleted || change.NewMode == filemode.Submodule {
+			continue
+		}
+		filePath := change.Path
+
+		content, err := g.getBlobContent(change.NewHash)
+		if err != nil {
+			return nil, fmt.Errorf("checking %s: %w", filePath, err)
+		}
+
+		if opts.MaxFileSize > 0 && int64(len(content)) > opts.MaxFileSize {
+			failures = append(failures, CheckFailure{
+				Path:   filePath,
+				Reason: fmt.Sprintf("file is %d bytes, larger than the %d byte limit", len(content), opts.MaxFileSize),
+			})
+		}
+
+		// Prompt exclusions are deliberately not applied: a secret in an
+		// excluded fixture would still be committed.
+		if isBinaryContent(content) {
+			continue
+		}
+
+		if opts.ConflictMarkers {
+			if loc := conflictMarker.FindStringIndex(content); loc != nil {
+				line := strings.Count(content[:loc[0]], "\n") + 1
+				failures = append(failures, CheckFailure{
+					Path:   filePath,
+					Reason: fmt.Sprintf("conflict marker at line %d", line),
+				})
+			}
+		}
+
+		if opts.Secrets {
+			for _, name := range detectSecrets(content) {
+				failures = append(failures, CheckFailure{
+					Path:   filePath,
+					Reason: fmt.Sprintf("possible %s", name),
+				})
+			}
+		}
+	}
+
+	sort.Slice(failures, func(i, j int) bool {
+		if failures[i].Path != failures[j].Path {
+			return failures[i].Path < failures[j].Path
+		}
+		return failures[i].Reason < failures[j].Reason
+	})
+
+	return failures, nil
+}
+
+// detectSecrets returns the names of the secret patterns found in content.
+func detectSecrets(content string) []string {
+	var found []string
+	for name, pattern := range secretPatterns {
+		if pattern.MatchString(content) {
+			found = append(found, name)
+		}
+	}
+	sort.Strings(found)
+	return found
+}
+
+func printCheckReport(w io.Writer, failures []CheckFailure) {
+	fmt.Fprintf(w, "Safety checks failed (%d problem(s)):\n", len(failures))
+	for _, f := range failures {
+		fmt.Fprintf(w, "  %s: %s\n", f.Path, f.Reason)
+	}
+}
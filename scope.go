@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// Where the scope of a changed file comes from when no -scope-map entry
+// matches it.
+const (
+	scopeFromDir     = "dir"     // Top-level directory
+	scopeFromPackage = "package" // Directory of a Go file, i.e. its package
+)
+
+const maxScopeChoices = 3 // More distinct scopes than this means no scope
+
+const scopePrompt = `
+
+# スコープ
+
+scope は変更されたパスから決めてある。%s
+`
+
+// scopeRule maps files matching a gitignore-style pattern to a scope.
+type scopeRule struct {
+	pattern gitignore.Pattern
+	scope   string
+}
+
+// parseScopeRules parses -scope-map values of the form PATTERN=SCOPE.
+func parseScopeRules(values []string) ([]scopeRule, error) {
+	var rules []scopeRule
+	for _, v := range values {
+		pattern, scope, ok := strings.Cut(v, "=")
+		if !ok || pattern == "" || scope == "" {
+			return nil, fmt.Errorf("invalid -scope-map %q: want PATTERN=SCOPE", v)
+		}
+		rules = append(rules, scopeRule{gitignore.ParsePattern(pattern, nil), scope})
+	}
+	return rules, nil
+}
+
+// fileScope returns the scope of one changed file, or "" for a file at
+// the root of the repository.
+func (g *CommitMessageGenerator) fileScope(filePath string) string {
+	parts := strings.Split(filePath, "/")
+	for _, rule := range g.scopeRules {
+		if rule.pattern.Match(parts, false) == gitignore.Exclude {
+			return rule.scope
+		}
+	}
+
+	if g.options.ScopeFrom == scopeFromPackage && strings.HasSuffix(filePath, ".go") {
+		if dir := path.Dir(filePath); dir != "." {
+			return path.Base(dir)
+		}
+		return ""
+	}
+	if len(parts) > 1 {
+		return parts[0]
+	}
+	return ""
+}
+
+// inferScopes returns the distinct scopes of the changed files, sorted.
+func (g *CommitMessageGenerator) inferScopes(patches []FilePatch) []string {
+	seen := map[string]bool{}
+	var scopes []string
+	for _, p := range patches {
+		if scope := g.fileScope(p.Path); scope != "" && !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+// allowedScopes returns the scopes the message may use; nil means that
+// the scope must be left out.
+func allowedScopes(scopes []string) []string {
+	if len(scopes) > maxScopeChoices {
+		return nil
+	}
+	return scopes
+}
+
+// scopeConstraint tells the model which scope to use instead of letting
+// it make one up.
+func scopeConstraint(scopes []string) string {
+	allowed := allowedScopes(scopes)
+	var rule string
+	switch {
+	case len(allowed) == 1:
+		rule = fmt.Sprintf("scope は `%s` とすること。", allowed[0])
+	case len(allowed) > 1:
+		rule = fmt.Sprintf("scope は %s のうち最も中心的なものとすること。", "`"+strings.Join(allowed, "`, `")+"`")
+	case len(scopes) > 0:
+		rule = "変更が複数の領域にまたがるため、scope は省略すること。"
+	default:
+		rule = "scope は省略すること。"
+	}
+	return fmt.Sprintf(scopePrompt, rule)
+}
+
+// checkScope reports a scope that is not among the inferred ones.
+func checkScope(scope string, scopes []string) string {
+	allowed := allowedScopes(scopes)
+	if scope == "" {
+		return ""
+	}
+	for _, s := range allowed {
+		if s == scope {
+			return ""
+		}
+	}
+	if len(allowed) == 0 {
+		return fmt.Sprintf("scope %q should be omitted", scope)
+	}
+	return fmt.Sprintf("scope %q is not one of %s", scope, strings.Join(allowed, ", "))
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// sendList decides which files' contents may leave the machine, from
+// -never-send and -send-only patterns in gitignore syntax. Unlike
+// -exclude, it applies to every way of collecting the diff and overrides
+// the lockfile and generated-file summaries.
+type sendList struct {
+	never gitignore.Matcher
+	only  gitignore.Matcher // nil allows every file
+}
+
+func newSendList(never []string, only []string) sendList {
+	compile := func(patterns []string) gitignore.Matcher {
+		if len(patterns) == 0 {
+			return nil
+		}
+		var compiled []gitignore.Pattern
+		for _, p := range patterns {
+			compiled = append(compiled, gitignore.ParsePattern(p, nil))
+		}
+		return gitignore.NewMatcher(compiled)
+	}
+	return sendList{never: compile(never), only: compile(only)}
+}
+
+// allows reports whether the content of filePath may be sent.
+func (s sendList) allows(filePath string) bool {
+	parts := strings.Split(filePath, "/")
+	if s.never != nil && s.never.Match(parts, false) {
+		return false
+	}
+	return s.only == nil || s.only.Match(parts, false)
+}
+
+// withhold replaces the patch of every file the send list does not allow,
+// under its old or its new name, with a line naming the file.
+func (s sendList) withhold(patches []FilePatch) []FilePatch {
+	if s.never == nil && s.only == nil {
+		return patches
+	}
+	kept := make([]FilePatch, len(patches))
+	for i, p := range patches {
+		kept[i] = p
+		from := renamedFrom(p.Patch)
+		if s.allows(p.Path) && (from == "" || s.allows(from)) {
+			continue
+		}
+		kept[i] = FilePatch{
+			Path:     p.Path,
+			Patch:    fmt.Sprintf("Withheld file: %s (changed; its content is never sent)\n", p.Path),
+			Excluded: true,
+		}
+	}
+	return kept
+}
+
+// renamedFrom returns the old path of a renamed file's patch, or "".
+func renamedFrom(patch string) string {
+	for _, line := range strings.Split(patch, "\n") {
+		if from, ok := strings.CutPrefix(line, "rename from "); ok {
+			return from
+		}
+		if strings.HasPrefix(line, "@@ ") {
+			break
+		}
+	}
+	return ""
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	gitconfig "github.com/go-git/go-git/v5/plumbing/format/config"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// sparseIndex reports whether the repository stores a sparse index
+// (`git sparse-checkout set --sparse-index`), which go-git cannot read.
+func (g *CommitMessageGenerator) sparseIndex() bool {
+	if g.repo == nil {
+		return false
+	}
+	cfg, err := g.repo.Config()
+	if err != nil {
+		return false
+	}
+	if cfg.Raw.Section("index").Option("sparse") == "true" {
+		return true
+	}
+
+	// git sparse-checkout writes it to the worktree's own config, which
+	// go-git does not read.
+	f, err := os.Open(filepath.Join(g.gitDir(), "config.worktree"))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	worktreeConfig := gitconfig.New()
+	if err := gitconfig.NewDecoder(f).Decode(worktreeConfig); err != nil {
+		return false
+	}
+	return worktreeConfig.Section("index").Option("sparse") == "true"
+}
+
+// readIndex reads the index git is using: the one named by GIT_INDEX_FILE
+// when set, as it is for the hooks of `git commit -a` and `git commit
+// <path>`, which stage into a temporary index, or else the repository's.
+func (g *CommitMessageGenerator) readIndex() (*index.Index, error) {
+	name := os.Getenv("GIT_INDEX_FILE")
+	if name == "" {
+		return g.repo.Storer.Index()
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	idx := &index.Index{}
+	if err := index.NewDecoder(f).Decode(idx); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return idx, nil
+}
+
+// indexEntries reads the index. Files outside a sparse checkout are not
+// on disk and carry the skip-worktree bit, so their content is always
+// read from the blob the index records. Directory entries of a sparse
+// index are expanded into the files of their tree.
+func (g *CommitMessageGenerator) indexEntries() ([]*index.Entry, error) {
+	idx, err := g.readIndex()
+	if err != nil {
+		if g.sparseIndex() {
+			return nil, fmt.Errorf("reading index: %w (sparse indexes need -backend git, or `git sparse-checkout set --no-sparse-index`)", err)
+		}
+		return nil, fmt.Errorf("reading index: %w", err)
+	}
+
+	var entries []*index.Entry
+	for _, entry := range idx.Entries {
+		if entry.Mode != filemode.Dir {
+			entries = append(entries, entry)
+			continue
+		}
+
+		tree, err := g.repo.TreeObject(entry.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("getting sparse directory %s: %w", entry.Name, err)
+		}
+		dir := strings.TrimSuffix(entry.Name, "/")
+		err = tree.Files().ForEach(func(f *object.File) error {
+			entries = append(entries, &index.Entry{
+				Name:         dir + "/" + f.Name,
+				Hash:         f.Hash,
+				Mode:         f.Mode,
+				Size:         uint32(f.Size),
+				SkipWorktree: true,
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("expanding sparse directory %s: %w", entry.Name, err)
+		}
+	}
+	return entries, nil
+}
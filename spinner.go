@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const spinnerInterval = 100 * time.Millisecond
+
+var spinnerFrames = []rune("⠋⠙⠹⠸⠼⠴⠦⠧⠇⠏")
+
+// spin is the status line shown on stderr during long silent waits. It is
+// disabled unless stderr is a terminal.
+var spin = &spinner{}
+
+// spinner redraws a status line next to a spinning indicator until it is
+// cleared. Its methods are no-ops while it is disabled.
+type spinner struct {
+	mu      sync.Mutex
+	w       io.Writer // nil when disabled
+	status  string
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+func (s *spinner) enable(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.w = w
+}
+
+// Status shows the formatted status, starting the spinner if needed.
+func (s *spinner) Status(format string, args ...any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.w == nil {
+		return
+	}
+	s.status = fmt.Sprintf(format, args...)
+	if s.stop != nil {
+		return
+	}
+	s.stop, s.stopped = make(chan struct{}), make(chan struct{})
+	go s.run(s.stop, s.stopped)
+}
+
+func (s *spinner) run(stop chan struct{}, stopped chan struct{}) {
+	defer close(stopped)
+	ticker := time.NewTicker(spinnerInterval)
+	defer ticker.Stop()
+	for frame := 0; ; frame++ {
+		s.mu.Lock()
+		fmt.Fprintf(s.w, "\r\033[K%c %s", spinnerFrames[frame%len(spinnerFrames)], s.status)
+		s.mu.Unlock()
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Clear stops the spinner and erases its line.
+func (s *spinner) Clear() {
+	s.mu.Lock()
+	stop, stopped := s.stop, s.stopped
+	s.stop, s.stopped = nil, nil
+	s.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-stopped
+	fmt.Fprint(s.w, "\r\033[K")
+}
+
+// clearingWriter clears the spinner before the first output written
+// through it, so streamed text starts on a clean line.
+type clearingWriter struct {
+	io.Writer
+}
+
+func (w clearingWriter) Write(p []byte) (int, error) {
+	spin.Clear()
+	return w.Writer.Write(p)
+}
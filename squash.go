@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const maxSquashLog = 100 // Squashed commits whose messages are sent
+
+const squashPrompt = `
+
+# スカッシュ
+
+以下の複数のコミットを1つにまとめる。入力データはそれらを合わせた差分である。個々のコミットを列挙するのではなく、全体として何をなぜ変更したのかを1つのコミットメッセージにまとめること。
+
+まとめるコミットのメッセージ（新しい順）:
+`
+
+// parseRange splits a `<base>..<head>` argument. A bare `<base>` means
+// `<base>..HEAD`.
+func parseRange(arg string) (base string, head string, err error) {
+	base, head, found := strings.Cut(arg, "..")
+	if !found {
+		head = "HEAD"
+	}
+	if strings.HasPrefix(head, ".") {
+		return "", "", fmt.Errorf("unsupported range %q: use <base>..<head>", arg)
+	}
+	if base == "" {
+		return "", "", fmt.Errorf("invalid range %q: missing base", arg)
+	}
+	if head == "" {
+		head = "HEAD"
+	}
+	return base, head, nil
+}
+
+// squashContext lists the messages of the commits being squashed. It also
+// moves the base of the diff to the merge base of the range, so that
+// changes made on the base branch meanwhile are not included.
+func (g *CommitMessageGenerator) squashContext() (string, error) {
+	from, to := g.options.Base, g.options.Head
+	base, err := g.resolveCommit(from)
+	if err != nil {
+		return "", err
+	}
+	head, err := g.resolveCommit(to)
+	if err != nil {
+		return "", err
+	}
+
+	bases, err := base.MergeBase(head)
+	if err != nil && isShallow(g.repo) {
+		return "", fmt.Errorf("finding merge base of %s and %s: %w (the clone is shallow; try git fetch --deepen)", from, to, err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("finding merge base of %s and %s: %w", from, to, err)
+	}
+	if len(bases) == 0 && isShallow(g.repo) {
+		return "", fmt.Errorf("%s and %s have no common history in this shallow clone; try git fetch --deepen", from, to)
+	}
+	if len(bases) == 0 {
+		return "", fmt.Errorf("%s and %s have no common history", from, to)
+	}
+	g.options.Base = bases[0].Hash.String()
+
+	commits, more, err := g.commitsBetween(bases[0].Hash, head.Hash, maxSquashLog)
+	if err != nil {
+		return "", err
+	}
+	if len(commits) == 0 {
+		return "", fmt.Errorf("no commits in %s..%s", from, to)
+	}
+
+	var b strings.Builder
+	b.WriteString(squashPrompt)
+	for _, c := range commits {
+		fmt.Fprintf(&b, "\n## %s\n\n%s\n", c.Hash.String()[:7], strings.TrimSpace(c.Message))
+	}
+	if more {
+		b.WriteString("\n...\n")
+	}
+
+	return b.String(), nil
+}
+
+func (g *CommitMessageGenerator) resolveCommit(rev string) (*object.Commit, error) {
+	hash, err := g.repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", rev, err)
+	}
+	commit, err := g.repo.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a commit: %w", rev, err)
+	}
+	return commit, nil
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// fileChange is a changed file: a difference between HEAD and the index,
+// i.e. what `git commit` would record, or between two trees. Whatever
+// found it, renderChange turns it into the patch that is sent.
+type fileChange struct {
+	Path    string
+	OldPath string         // Set for renames
+	Action  git.StatusCode // git.Added, git.Modified, git.Deleted or git.Renamed
+	OldHash plumbing.Hash
+	NewHash plumbing.Hash
+	OldMode filemode.FileMode
+	NewMode filemode.FileMode
+}
+
+type treeEntry struct {
+	Hash plumbing.Hash
+	Mode filemode.FileMode
+}
+
+// stagedChanges compares the index with the HEAD tree, sorted by path.
+// With -all, tracked files are taken from the worktree instead, like
+// `git commit -a`; so are files added with `git add -N`.
+func (g *CommitMessageGenerator) stagedChanges() ([]fileChange, error) {
+	entries, err := g.indexEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := g.headEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []fileChange
+	indexed := map[string]bool{}
+	for _, entry := range entries {
+		if entry.Stage != 0 {
+			continue // Unresolved merge conflict
+		}
+
+		current := treeEntry{Hash: entry.Hash, Mode: entry.Mode}
+		// An intent-to-add entry (git add -N) records an empty blob; what
+		// will be committed is the file in the worktree.
+		if g.options.All || entry.IntentToAdd {
+			var exists bool
+			current, exists, err = g.worktreeEntry(entry)
+			if err != nil {
+				return nil, err
+			}
+			if !exists {
+				continue // Removed from the worktree; reported as deleted below
+			}
+		}
+		indexed[entry.Name] = true
+
+		old, inHead := head[entry.Name]
+		switch {
+		case !inHead:
+			changes = append(changes, fileChange{
+				Path:    entry.Name,
+				Action:  git.Added,
+				NewHash: current.Hash,
+				NewMode: current.Mode,
+			})
+		case old.Hash != current.Hash || old.Mode != current.Mode:
+			changes = append(changes, fileChange{
+				Path:    entry.Name,
+				Action:  git.Modified,
+				OldHash: old.Hash,
+				NewHash: current.Hash,
+				OldMode: old.Mode,
+				NewMode: current.Mode,
+			})
+		}
+	}
+
+	for path, old := range head {
+		if indexed[path] {
+			continue
+		}
+		changes = append(changes, fileChange{
+			Path:    path,
+			Action:  git.Deleted,
+			OldHash: old.Hash,
+			OldMode: old.Mode,
+		})
+	}
+
+	// Deletions were found in map order; sort before pairing renames so
+	// that ties between equally similar files are broken the same way
+	// every run.
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+
+	changes, err = g.detectRenames(changes)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := changes[:0]
+	for _, c := range changes {
+		if g.pathspec.Match(c.Path, c.OldPath) {
+			selected = append(selected, c)
+		}
+	}
+	return selected, nil
+}
+
+const renameThreshold = 0.5        // Minimum similarity for a delete+add pair to count as a rename
+const maxRenameCandidates = 100    // Per side; beyond this only exact renames are detected
+const maxRenameCompareLines = 2000 // Larger files are only matched exactly
+
+// detectRenames pairs deleted and added files with identical or similar
+// content into renames, like `git diff --find-renames`.
+func (g *CommitMessageGenerator) detectRenames(changes []fileChange) ([]fileChange, error) {
+	var added, deleted []int
+	for i, c := range changes {
+		switch c.Action {
+		case git.Added:
+			added = append(added, i)
+		case git.Deleted:
+			deleted = append(deleted, i)
+		}
+	}
+	if len(added) == 0 || len(deleted) == 0 {
+		return changes, nil
+	}
+
+	paired := map[int]bool{}
+	pair := func(a, d int) {
+		changes[a].Action = git.Renamed
+		changes[a].OldPath = changes[d].Path
+		changes[a].OldHash = changes[d].OldHash
+		changes[a].OldMode = changes[d].OldMode
+		paired[a], paired[d] = true, true
+	}
+
+	// Exact renames first: same blob under a new path.
+	for _, a := range added {
+		for _, d := range deleted {
+			if !paired[d] && changes[a].NewHash == changes[d].OldHash {
+				pair(a, d)
+				break
+			}
+		}
+	}
+
+	if len(added) <= maxRenameCandidates && len(deleted) <= maxRenameCandidates {
+		lines := map[plumbing.Hash][]string{}
+		contentLines := func(hash plumbing.Hash) ([]string, error) {
+			if l, ok := lines[hash]; ok {
+				return l, nil
+			}
+			content, err := g.getBlobContent(hash)
+			if err != nil {
+				return nil, err
+			}
+			// Not difflib.SplitLines, which adds an empty last line that
+			// makes any two one-line files half similar.
+			l := strings.SplitAfter(strings.TrimSuffix(content, "\n"), "\n")
+			if len(l) > maxRenameCompareLines || isBinaryContent(content) {
+				l = nil
+			}
+			lines[hash] = l
+			return l, nil
+		}
+
+		for _, a := range added {
+			if paired[a] {
+				continue
+			}
+			newLines, err := contentLines(changes[a].NewHash)
+			if err != nil || newLines == nil {
+				continue
+			}
+
+			best, bestScore := -1, renameThreshold
+			for _, d := range deleted {
+				if paired[d] {
+					continue
+				}
+				oldLines, err := contentLines(changes[d].OldHash)
+				if err != nil || oldLines == nil {
+					continue
+				}
+				matcher := difflib.NewMatcher(oldLines, newLines)
+				if matcher.QuickRatio() < bestScore {
+					continue
+				}
+				if score := matcher.Ratio(); score >= bestScore {
+					best, bestScore = d, score
+				}
+			}
+			if best != -1 {
+				pair(a, best)
+			}
+		}
+	}
+
+	var result []fileChange
+	for i, c := range changes {
+		if paired[i] && c.Action != git.Renamed {
+			continue // The deleted half of a rename
+		}
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+// headEntries returns every non-directory entry of the HEAD tree by path.
+// Before the first commit there is no HEAD and every staged file is new.
+func (g *CommitMessageGenerator) headEntries() (map[string]treeEntry, error) {
+	entries := map[string]treeEntry{}
+
+	head, err := g.repo.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting HEAD: %w", err)
+	}
+
+	commit, err := g.repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("getting commit object: %w", err)
+	}
+
+	// With -amend the new commit replaces HEAD, so compare with its parent.
+	if g.options.Amend {
+		if commit.NumParents() == 0 {
+			return entries, nil
+		}
+		if commit, err = commit.Parent(0); err != nil {
+			return nil, fmt.Errorf("getting parent of HEAD: %w", err)
+		}
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("getting tree: %w", err)
+	}
+
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("walking HEAD tree: %w", err)
+		}
+		if entry.Mode == filemode.Dir {
+			continue
+		}
+		entries[name] = treeEntry{Hash: entry.Hash, Mode: entry.Mode}
+	}
+
+	return entries, nil
+}
+
+// getBlobContent reads a blob from the object database, or from the
+// worktree files read for -all.
+func (g *CommitMessageGenerator) getBlobContent(hash plumbing.Hash) (string, error) {
+	if content, ok := g.worktreeBlobs[hash]; ok {
+		return content, nil
+	}
+
+	g.blobMu.Lock()
+	defer g.blobMu.Unlock()
+	blob, err := g.repo.BlobObject(hash)
+	if err != nil {
+		return "", fmt.Errorf("getting blob %s: %w", hash, err)
+	}
+
+	reader, err := blob.Reader()
+	if err != nil {
+		return "", fmt.Errorf("opening blob %s: %w", hash, err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return "", fmt.Errorf("reading blob %s: %w", hash, err)
+	}
+
+	return string(content), nil
+}
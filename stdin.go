@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	pathpkg "path"
+	"strings"
+)
+
+// readDiff splits a unified diff, as printed by `git diff` or `diff -u`,
+// into per-file patches. Files start at "diff --git" lines, or at
+// "---"/"+++" header pairs for plain unified diffs.
+func (g *CommitMessageGenerator) readDiff(r io.Reader) ([]FilePatch, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading diff: %w", err)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+
+	var patches []FilePatch
+	var current strings.Builder
+	var path string
+	flush := func() {
+		if current.Len() == 0 {
+			return
+		}
+		patches = append(patches, g.filterPatch(path, current.String()))
+		current.Reset()
+	}
+
+	gitDiff := false
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flush()
+			gitDiff = true
+			path = diffGitPath(strings.TrimRight(line, "\n"))
+		case strings.HasPrefix(line, "Submodule "):
+			// `git diff --submodule=log` summarizes submodules without a diff header
+			flush()
+			path, _, _ = strings.Cut(strings.TrimPrefix(line, "Submodule "), " ")
+		case !gitDiff && strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			flush()
+			path = headerPath(lines[i+1][len("+++ "):])
+			if path == "" { // Deleted file
+				path = headerPath(line[len("--- "):])
+			}
+		}
+		current.WriteString(line)
+	}
+	flush()
+
+	return patches, nil
+}
+
+// filterPatch applies to a patch read as text the exclusions and summaries
+// renderChange applies to the files of a repository, as far as the patch
+// shows the files: of a modified file only the hunks are known, so
+// lockfiles and Go declarations are only summarized for added and deleted
+// files.
+func (g *CommitMessageGenerator) filterPatch(path string, patch string) FilePatch {
+	if path == "" {
+		return FilePatch{Patch: patch}
+	}
+	_, lockfile := lockfileParsers[pathpkg.Base(path)]
+	if !lockfile && g.excludedPath(path) || isBinaryPatch(patch) {
+		return excludedPatch(path)
+	}
+
+	patch, encoding := toUTF8(patch)
+	oldContent, newContent, whole := patchContents(patch)
+	if whole {
+		if summary, ok := summarizeLockfile(path, oldContent, newContent); ok {
+			return FilePatch{Path: path, Patch: summary}
+		}
+	}
+	if g.excludedPath(path) || g.exclusions.exceedsSizeLimit(path, len(oldContent)) || g.exclusions.exceedsSizeLimit(path, len(newContent)) {
+		return excludedPatch(path)
+	}
+	if g.isGenerated(path, oldContent, newContent) {
+		return generatedPatch(path, oldContent, newContent)
+	}
+	if whole {
+		patch = withGoSummary(path, patch, oldContent, newContent)
+	}
+	return FilePatch{Path: path, Patch: noteEncoding(patch, encoding)}
+}
+
+// isBinaryPatch reports whether git described a file as binary, or the
+// patch holds NUL bytes.
+func isBinaryPatch(patch string) bool {
+	return strings.Contains(patch, "\nGIT binary patch\n") || strings.Contains(patch, "\nBinary files ") ||
+		strings.HasPrefix(patch, "Binary files ") || isBinaryContent(patch)
+}
+
+// patchContents rebuilds the old and new sides of a file from the hunks of
+// its patch. whole reports whether they are the complete file, which is
+// only known for added and deleted files.
+func patchContents(patch string) (oldContent string, newContent string, whole bool) {
+	var before, after strings.Builder
+	inHunks := false
+	for _, line := range strings.SplitAfter(patch, "\n") {
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			inHunks = true
+		case !inHunks:
+			if strings.HasPrefix(line, "new file mode") || strings.HasPrefix(line, "deleted file mode") ||
+				line == "--- /dev/null\n" || line == "+++ /dev/null\n" {
+				whole = true
+			}
+		case strings.HasPrefix(line, " "):
+			before.WriteString(line[1:])
+			after.WriteString(line[1:])
+		case strings.HasPrefix(line, "-"):
+			before.WriteString(line[1:])
+		case strings.HasPrefix(line, "+"):
+			after.WriteString(line[1:])
+		}
+	}
+	return before.String(), after.String(), whole
+}
+
+// getDiffFrom reads the patches to describe from a unified diff in r,
+// keeping only files selected by the pathspec.
+func (g *CommitMessageGenerator) getDiffFrom(r io.Reader) ([]FilePatch, error) {
+	patches, err := g.readDiff(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []FilePatch
+	for _, p := range patches {
+		if g.pathspec.Match(p.Path) {
+			selected = append(selected, p)
+		}
+	}
+	return selected, nil
+}
+
+// diffGitPath extracts the new path from a "diff --git a/x b/x" line.
+func diffGitPath(line string) string {
+	rest := strings.TrimPrefix(line, "diff --git ")
+	if i := strings.LastIndex(rest, " b/"); i >= 0 {
+		return strings.Trim(rest[i+len(" b/"):], `"`)
+	}
+	return ""
+}
+
+// headerPath extracts the path from the value of a "---" or "+++" header,
+// dropping the "b/" prefix and any timestamp.
+func headerPath(value string) string {
+	value = strings.TrimRight(value, "\n")
+	value, _, _ = strings.Cut(value, "\t")
+	value = strings.Trim(value, `"`)
+	if value == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(value, "a/") || strings.HasPrefix(value, "b/") {
+		value = value[2:]
+	}
+	return value
+}
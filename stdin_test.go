@@ -0,0 +1,157 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHeaderPath(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"b/src/main.c\n", "src/main.c"},
+		{"a/src/main.c", "src/main.c"},
+		{"src/main.c\t2024-01-02 10:00:00.000000000 +0900\n", "src/main.c"},
+		{`"b/with space.txt"`, "with space.txt"},
+		{"/dev/null\n", ""},
+	}
+	for _, tt := range tests {
+		if got := headerPath(tt.value); got != tt.want {
+			t.Errorf("headerPath(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestDiffGitPath(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"diff --git a/main.go b/main.go", "main.go"},
+		{"diff --git a/old.go b/new/name.go", "new/name.go"},
+		{"diff --git a/with space.txt b/with space.txt", "with space.txt"},
+		{"diff --git x y", ""},
+	}
+	for _, tt := range tests {
+		if got := diffGitPath(tt.line); got != tt.want {
+			t.Errorf("diffGitPath(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestPatchContents(t *testing.T) {
+	tests := []struct {
+		name     string
+		patch    string
+		old, new string
+		whole    bool
+	}{
+		{
+			name:  "added",
+			patch: "diff --git a/a.txt b/a.txt\nnew file mode 100644\n--- /dev/null\n+++ b/a.txt\n@@ -0,0 +1,2 @@\n+one\n+two\n",
+			new:   "one\ntwo\n",
+			whole: true,
+		},
+		{
+			name:  "deleted without git header",
+			patch: "--- a.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-one\n",
+			old:   "one\n",
+			whole: true,
+		},
+		{
+			name:  "modified",
+			patch: "--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n keep\n-old\n+new\n",
+			old:   "keep\nold\n",
+			new:   "keep\nnew\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old, new, whole := patchContents(tt.patch)
+			if old != tt.old || new != tt.new || whole != tt.whole {
+				t.Errorf("got %q, %q, %v; want %q, %q, %v", old, new, whole, tt.old, tt.new, tt.whole)
+			}
+		})
+	}
+}
+
+func TestIsBinaryPatch(t *testing.T) {
+	tests := []struct {
+		patch string
+		want  bool
+	}{
+		{"diff --git a/x.png b/x.png\nindex 1..2 100644\nBinary files a/x.png and b/x.png differ\n", true},
+		{"Binary files /dev/null and b/x.png differ\n", true},
+		{"diff --git a/x.png b/x.png\nGIT binary patch\nliteral 4\n", true},
+		{"+a\x00b\n", true},
+		{"@@ -1 +1 @@\n-Binary files are\n+text\n", false},
+	}
+	for _, tt := range tests {
+		if got := isBinaryPatch(tt.patch); got != tt.want {
+			t.Errorf("isBinaryPatch(%q) = %v, want %v", tt.patch, got, tt.want)
+		}
+	}
+}
+
+func TestReadDiff(t *testing.T) {
+	tests := []struct {
+		name  string
+		diff  string
+		paths []string
+		// Prefix of each patch read, in order.
+		prefixes []string
+	}{
+		{
+			name: "git diff",
+			diff: "diff --git a/a.txt b/a.txt\n--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-x\n+y\n" +
+				"diff --git a/logo.png b/logo.png\nBinary files a/logo.png and b/logo.png differ\n",
+			paths:    []string{"a.txt", "logo.png"},
+			prefixes: []string{"diff --git a/a.txt b/a.txt\n", "Excluded file: logo.png"},
+		},
+		{
+			name: "plain unified diff",
+			diff: "--- a.txt\t2024-01-02\n+++ a.txt\t2024-01-03\n@@ -1 +1 @@\n-x\n+y\n" +
+				"--- old.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-z\n",
+			paths:    []string{"a.txt", "old.txt"},
+			prefixes: []string{"--- a.txt\t", "--- old.txt\n"},
+		},
+		{
+			name: "submodule log",
+			diff: "Submodule vendor/lib 1234567..89abcde:\n  > Fix the build\n" +
+				"diff --git a/a.txt b/a.txt\n@@ -1 +1 @@\n-x\n+y\n",
+			paths:    []string{"vendor/lib", "a.txt"},
+			prefixes: []string{"Submodule vendor/lib", "diff --git"},
+		},
+		{
+			name: "lockfile is summarized",
+			diff: "diff --git a/yarn.lock b/yarn.lock\nnew file mode 100644\n--- /dev/null\n+++ b/yarn.lock\n@@ -0,0 +1,2 @@\n" +
+				"+a@^1:\n+  version \"1.0.0\"\n",
+			paths:    []string{"yarn.lock"},
+			prefixes: []string{"Lockfile yarn.lock: 0 packages updated, 1 added"},
+		},
+		{
+			name:     "text before the first file",
+			diff:     "From 1234 Mon Sep 17 00:00:00 2001\nSubject: x\n\ndiff --git a/a.txt b/a.txt\n@@ -1 +1 @@\n-x\n+y\n",
+			paths:    []string{"", "a.txt"},
+			prefixes: []string{"From 1234", "diff --git"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &CommitMessageGenerator{exclusions: newExclusions(ExclusionRules{})}
+			patches, err := g.readDiff(strings.NewReader(tt.diff))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(patches) != len(tt.paths) {
+				t.Fatalf("read %d patches, want %d: %+v", len(patches), len(tt.paths), patches)
+			}
+			for i, p := range patches {
+				if p.Path != tt.paths[i] || !strings.HasPrefix(p.Patch, tt.prefixes[i]) {
+					t.Errorf("patch %d is %q: %q; want %q: %q...", i, p.Path, p.Patch, tt.paths[i], tt.prefixes[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// StructuredMessage is the commit message as returned in structured mode.
+type StructuredMessage struct {
+	Type    string `json:"type"`
+	Scope   string `json:"scope"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// ResponseFormat is the OpenAI response_format request field.
+type ResponseFormat struct {
+	Type       string      `json:"type"`
+	JSONSchema *JSONSchema `json:"json_schema,omitempty"`
+}
+
+type JSONSchema struct {
+	Name   string         `json:"name"`
+	Strict bool           `json:"strict"`
+	Schema map[string]any `json:"schema"`
+}
+
+var structuredMessageSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"type":    map[string]any{"type": "string", "description": "change type such as feat, fix, refactor, docs, test, chore"},
+		"scope":   map[string]any{"type": "string", "description": "area of the code base affected, or empty"},
+		"subject": map[string]any{"type": "string", "description": "one line summary"},
+		"body":    map[string]any{"type": "string", "description": "optional longer explanation, or empty"},
+	},
+	"required":             []string{"type", "scope", "subject", "body"},
+	"additionalProperties": false,
+}
+
+const structuredPrompt = `
+
+# 出力形式
+
+次のキーを持つ JSON オブジェクトのみを出力すること。
+
+- type: 変更の種類（feat, fix, refactor, docs, test, chore など）
+- scope: 影響範囲（なければ空文字列）
+- subject: コミットメッセージの1行目
+- body: 補足説明（なければ空文字列）
+`
+
+// responseFormat returns the response_format to request. Endpoints that
+// support JSON schemas get the full schema; the others get plain JSON mode
+// and rely on the prompt for the shape.
+func responseFormat(jsonSchema bool) *ResponseFormat {
+	if !jsonSchema {
+		return &ResponseFormat{Type: "json_object"}
+	}
+	return &ResponseFormat{
+		Type: "json_schema",
+		JSONSchema: &JSONSchema{
+			Name:   "commit_message",
+			Strict: true,
+			Schema: structuredMessageSchema,
+		},
+	}
+}
+
+// parseStructuredMessage decodes a structured response, tolerating a code
+// fence or text around the JSON object.
+func parseStructuredMessage(content string) (*StructuredMessage, error) {
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start == -1 || end < start {
+		return nil, fmt.Errorf("no JSON object in response: %s", content)
+	}
+
+	var msg StructuredMessage
+	if err := json.Unmarshal([]byte(content[start:end+1]), &msg); err != nil {
+		return nil, fmt.Errorf("unmarshaling structured message: %w", err)
+	}
+	if strings.TrimSpace(msg.Subject) == "" {
+		return nil, fmt.Errorf("structured message has no subject: %s", content)
+	}
+
+	return &msg, nil
+}
+
+// Text renders the structured message as a plain commit message.
+func (m *StructuredMessage) Text() string {
+	subject := strings.TrimSpace(m.Subject)
+	body := strings.TrimSpace(m.Body)
+	if body == "" {
+		return subject
+	}
+	return subject + "\n\n" + body
+}
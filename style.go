@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// Filters for the commits -style-history learns from.
+const (
+	styleMine     = "mine"      // Only commits by the current author
+	styleNoMerges = "no-merges" // Skip merge commits
+	styleNoBots   = "no-bots"   // Skip commits by bots such as dependabot
+)
+
+const styleHistoryPrompt = `
+
+# 過去のコミットメッセージ
+
+このリポジトリの過去のコミットメッセージの例を示す。言語、長さ、書式（接頭辞、句読点、本文の有無など）をこれに合わせること。内容は真似しないこと。
+`
+
+// botAuthor matches the names and emails bots commit with.
+var botAuthor = regexp.MustCompile(`(?i)\[bot\]|^(dependabot|renovate|greenkeeper|github-actions|snyk-bot)\b`)
+
+// checkStyleFilters rejects unknown -style-filter values.
+func checkStyleFilters(filters []string) error {
+	for _, f := range filters {
+		switch f {
+		case styleMine, styleNoMerges, styleNoBots:
+		default:
+			return fmt.Errorf("unknown -style-filter %q (want %s, %s or %s)", f, styleMine, styleNoMerges, styleNoBots)
+		}
+	}
+	return nil
+}
+
+// styleContext shows recent commit messages as examples of the style to
+// follow. Reading history is best effort: any failure just means no
+// examples.
+func (g *CommitMessageGenerator) styleContext() string {
+	examples := g.styleExamples()
+	if len(examples) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(styleHistoryPrompt)
+	for _, example := range examples {
+		fmt.Fprintf(&b, "\n```\n%s\n```\n", example)
+	}
+	return b.String()
+}
+
+// styleExamples looks at up to -style-history commits from HEAD that pass
+// -style-filter and picks -style-examples of them spread evenly over that
+// range, since the few most recent commits are often unrepresentative.
+func (g *CommitMessageGenerator) styleExamples() []string {
+	depth, count := g.options.StyleHistory, g.options.StyleExamples
+	if g.repo == nil || depth <= 0 || count <= 0 {
+		return nil
+	}
+	head := g.headCommit()
+	if head == nil {
+		return nil
+	}
+
+	filters := map[string]bool{}
+	for _, f := range g.options.StyleFilters {
+		filters[f] = true
+	}
+	var email string
+	if filters[styleMine] {
+		if email = g.authorEmail(); email == "" {
+			return nil
+		}
+	}
+
+	commits := walkHistory(g.repo, head, nil)
+	defer commits.Close()
+
+	var messages []string
+	seen := 0
+	_ = commits.ForEach(func(c *object.Commit) error {
+		if seen == depth {
+			return storer.ErrStop
+		}
+		seen++
+		switch {
+		case filters[styleNoMerges] && c.NumParents() > 1:
+		case filters[styleNoBots] && (botAuthor.MatchString(c.Author.Name) || botAuthor.MatchString(c.Author.Email)):
+		case filters[styleMine] && !strings.EqualFold(c.Author.Email, email):
+		default:
+			if message := strings.TrimSpace(c.Message); message != "" {
+				messages = append(messages, message)
+			}
+		}
+		return nil
+	})
+
+	if len(messages) <= count {
+		return messages
+	}
+	examples := make([]string, count)
+	for i := range examples {
+		examples[i] = messages[i*len(messages)/count]
+	}
+	return examples
+}
+
+// authorEmail returns the email new commits are authored with.
+func (g *CommitMessageGenerator) authorEmail() string {
+	if email := os.Getenv("GIT_AUTHOR_EMAIL"); email != "" {
+		return email
+	}
+	cfg, err := g.repo.ConfigScoped(config.GlobalScope)
+	if err != nil {
+		return ""
+	}
+	return cfg.User.Email
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+const maxSubmoduleLog = 20 // Commits listed per submodule with -submodule-log
+
+// formatSubmodulePatch renders a gitlink change the way `git diff` does,
+// optionally followed by the submodule's own log between the two commits.
+func formatSubmodulePatch(path string, oldHash plumbing.Hash, newHash plumbing.Hash, log []string) string {
+	var diff strings.Builder
+	diff.WriteString(fmt.Sprintf("diff --git a/%s b/%s\n", path, path))
+	switch {
+	case oldHash.IsZero():
+		diff.WriteString("new file mode 160000\n")
+		diff.WriteString("--- /dev/null\n")
+		diff.WriteString(fmt.Sprintf("+++ b/%s\n", path))
+		diff.WriteString("@@ -0,0 +1 @@\n")
+		diff.WriteString(fmt.Sprintf("+Subproject commit %s\n", newHash))
+	case newHash.IsZero():
+		diff.WriteString("deleted file mode 160000\n")
+		diff.WriteString(fmt.Sprintf("--- a/%s\n", path))
+		diff.WriteString("+++ /dev/null\n")
+		diff.WriteString("@@ -1 +0,0 @@\n")
+		diff.WriteString(fmt.Sprintf("-Subproject commit %s\n", oldHash))
+	default:
+		diff.WriteString(fmt.Sprintf("--- a/%s\n", path))
+		diff.WriteString(fmt.Sprintf("+++ b/%s\n", path))
+		diff.WriteString("@@ -1 +1 @@\n")
+		diff.WriteString(fmt.Sprintf("-Subproject commit %s\n", oldHash))
+		diff.WriteString(fmt.Sprintf("+Subproject commit %s\n", newHash))
+	}
+
+	if len(log) > 0 {
+		diff.WriteString(fmt.Sprintf("Submodule %s %s..%s:\n", path, oldHash.String()[:7], newHash.String()[:7]))
+		for _, line := range log {
+			diff.WriteString("  > " + line + "\n")
+		}
+	}
+
+	return diff.String()
+}
+
+// submoduleLog lists the subjects of the submodule commits reachable from
+// newHash but not from oldHash. It returns nothing when the submodule is not
+// checked out or the commits are unknown locally.
+func (g *CommitMessageGenerator) submoduleLog(path string, oldHash plumbing.Hash, newHash plumbing.Hash) []string {
+	if g.worktree == nil || oldHash.IsZero() || newHash.IsZero() {
+		return nil
+	}
+
+	sub, err := git.PlainOpen(filepath.Join(g.worktree.Filesystem.Root(), path))
+	if err != nil {
+		return nil
+	}
+
+	from, err := sub.CommitObject(newHash)
+	if err != nil {
+		return nil
+	}
+	commits := walkHistory(sub, from, nil)
+	defer commits.Close()
+
+	var log []string
+	err = commits.ForEach(func(c *object.Commit) error {
+		if c.Hash == oldHash {
+			return storer.ErrStop
+		}
+		if len(log) == maxSubmoduleLog {
+			log = append(log, "...")
+			return storer.ErrStop
+		}
+		subject, _, _ := strings.Cut(c.Message, "\n")
+		log = append(log, fmt.Sprintf("%s %s", c.Hash.String()[:7], subject))
+		return nil
+	})
+	if err != nil && !errors.Is(err, storer.ErrStop) {
+		return nil
+	}
+
+	return log
+}
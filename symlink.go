@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+)
+
+// formatSymlinkPatch renders a change involving a symbolic link the way
+// git does: the blob of a link is its target path, shown without a
+// trailing newline. A change between a link and a regular file is shown
+// as a deletion followed by an addition. Empty contents with a zero mode
+// stand for a missing side.
+func formatSymlinkPatch(filePath string, oldContent string, newContent string, oldMode filemode.FileMode, newMode filemode.FileMode) string {
+	if oldMode != 0 && newMode != 0 && oldMode != newMode {
+		// Type change
+		return formatSymlinkPatch(filePath, oldContent, "", oldMode, 0) +
+			formatSymlinkPatch(filePath, "", newContent, 0, newMode)
+	}
+
+	if oldMode != filemode.Symlink && newMode != filemode.Symlink {
+		if oldMode == 0 {
+			return formatAddedPatch(filePath, newContent, newMode)
+		}
+		return formatDeletedPatch(filePath, oldContent, oldMode)
+	}
+
+	var diff bytes.Buffer
+	diff.WriteString(fmt.Sprintf("diff --git a/%s b/%s\n", filePath, filePath))
+	switch {
+	case oldMode == 0:
+		diff.WriteString(fmt.Sprintf("new file mode %s\n", modeString(newMode)))
+		diff.WriteString("--- /dev/null\n")
+		diff.WriteString(fmt.Sprintf("+++ b/%s\n", filePath))
+		diff.WriteString("@@ -0,0 +1 @@\n")
+	case newMode == 0:
+		diff.WriteString(fmt.Sprintf("deleted file mode %s\n", modeString(oldMode)))
+		diff.WriteString(fmt.Sprintf("--- a/%s\n", filePath))
+		diff.WriteString("+++ /dev/null\n")
+		diff.WriteString("@@ -1 +0,0 @@\n")
+	default:
+		diff.WriteString(fmt.Sprintf("--- a/%s\n", filePath))
+		diff.WriteString(fmt.Sprintf("+++ b/%s\n", filePath))
+		diff.WriteString("@@ -1 +1 @@\n")
+	}
+	if oldMode != 0 {
+		diff.WriteString("-" + oldContent + "\n\\ No newline at end of file\n")
+	}
+	if newMode != 0 {
+		diff.WriteString("+" + newContent + "\n\\ No newline at end of file\n")
+	}
+
+	return diff.String()
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+const completionReserve = 1024 // Tokens kept free for the generated message
+const maxBytesPerToken = 8     // Upper bound used to pre-cut huge patches before tokenizing
+
+// modelContextWindows lists the context size, in tokens, of each model we
+// send prompts to.
+var modelContextWindows = map[string]int{
+	"llama3-70b-8192":        8192,
+	"gpt-4o-mini-2024-07-18": 128000,
+}
+
+const defaultContextWindow = 8192
+
+var (
+	encodings   = map[string]*tiktoken.Tiktoken{}
+	encodingsMu sync.Mutex
+)
+
+func init() {
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+// TokenCounter counts prompt tokens with the tokenizer of a specific model.
+type TokenCounter struct {
+	encoding *tiktoken.Tiktoken
+}
+
+// newTokenCounter returns a counter for model. OpenAI models use their own
+// encoding; other models (Groq's Llama 3) are approximated with cl100k_base.
+func newTokenCounter(model string) (*TokenCounter, error) {
+	name := tiktoken.MODEL_CL100K_BASE
+	if strings.HasPrefix(model, "gpt-4o") {
+		name = tiktoken.MODEL_O200K_BASE
+	}
+
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+
+	if enc, ok := encodings[name]; ok {
+		return &TokenCounter{encoding: enc}, nil
+	}
+	enc, err := tiktoken.GetEncoding(name)
+	if err != nil {
+		return nil, fmt.Errorf("loading %s tokenizer: %w", name, err)
+	}
+	encodings[name] = enc
+
+	return &TokenCounter{encoding: enc}, nil
+}
+
+func (c *TokenCounter) Count(text string) int {
+	return len(c.encoding.EncodeOrdinary(text))
+}
+
+// promptBudget returns how many tokens of diff fit into model's context
+// next to the system prompt and the reserved completion. maxTokens, when
+// set, replaces the default completion reserve.
+func (c *TokenCounter) promptBudget(model string, systemPrompt string, maxTokens int) int {
+	window, ok := modelContextWindows[model]
+	if !ok {
+		window = defaultContextWindow
+	}
+	reserve := completionReserve
+	if maxTokens > 0 {
+		reserve = maxTokens
+	}
+	return window - reserve - c.Count(systemPrompt)
+}
+
+// FilePatch is the prompt fragment generated for a single staged file.
+type FilePatch struct {
+	Path     string
+	Patch    string
+	Excluded bool
+}
+
+// fitPatches joins patches into a diff of at most budget tokens. When
+// everything does not fit, files are taken by relevance (source, tests,
+// docs, config, generated), smallest first within a rank, and the files
+// left over are listed as a diffstat. If not even the most relevant file
+// fits, it is truncated rather than dropped. When not even the diffstat
+// fits, only a summary with per-directory totals is sent.
+func fitPatches(patches []FilePatch, budget int, counter *TokenCounter) (string, DiffReport) {
+	var report DiffReport
+
+	sizes := make([]int, len(patches))
+	total := 0 // Of the files that are not excluded
+	var candidates []int
+	for i, p := range patches {
+		sizes[i] = counter.Count(firstBytes(p.Patch, budget*maxBytesPerToken))
+		if p.Excluded {
+			report.Excluded = append(report.Excluded, p.Path)
+			budget -= sizes[i]
+			continue
+		}
+		candidates = append(candidates, i)
+		total += sizes[i]
+	}
+
+	included := make([]bool, len(patches))
+	if total <= budget {
+		for i := range patches {
+			included[i] = true
+		}
+	} else {
+		sort.SliceStable(candidates, func(a, b int) bool {
+			ra, rb := relevanceRank(patches[candidates[a]]), relevanceRank(patches[candidates[b]])
+			if ra != rb {
+				return ra < rb
+			}
+			return sizes[candidates[a]] < sizes[candidates[b]]
+		})
+
+		// Every omitted file costs a diffstat line; reserve those first.
+		remaining := budget - counter.Count(omittedHeader)
+		stats := make([]int, len(patches))
+		for _, i := range candidates {
+			stats[i] = counter.Count(diffstatLine(patches[i]))
+			remaining -= stats[i]
+		}
+		if remaining < 0 {
+			return summarizeOnly(patches, budget, counter, report)
+		}
+		for _, i := range candidates {
+			if sizes[i] <= remaining+stats[i] {
+				included[i] = true
+				remaining -= sizes[i] - stats[i]
+			}
+		}
+		for i, p := range patches {
+			if !included[i] && !p.Excluded {
+				report.Omitted = append(report.Omitted, p.Path)
+			}
+		}
+
+		if len(candidates) > 0 && !included[candidates[0]] && remaining+stats[candidates[0]] > 0 {
+			first := candidates[0]
+			included[first] = true
+			report.Omitted = removeString(report.Omitted, patches[first].Path)
+			report.Truncated = append(report.Truncated, patches[first].Path)
+			patches = append([]FilePatch(nil), patches...)
+			patches[first].Patch = truncatePatch(patches[first].Patch, remaining+stats[first], counter)
+		}
+	}
+
+	var diff, omitted strings.Builder
+	for i, p := range patches {
+		if included[i] || p.Excluded {
+			diff.WriteString(p.Patch)
+		} else {
+			omitted.WriteString(diffstatLine(p))
+		}
+	}
+	if omitted.Len() > 0 {
+		diff.WriteString(omittedHeader)
+		diff.WriteString(omitted.String())
+	}
+
+	sort.Strings(report.Excluded)
+	sort.Strings(report.Truncated)
+	sort.Strings(report.Omitted)
+
+	return diff.String(), report
+}
+
+// summarizeOnly replaces the whole diff with a diffstat summary, keeping
+// only the notes about excluded files.
+func summarizeOnly(patches []FilePatch, budget int, counter *TokenCounter, report DiffReport) (string, DiffReport) {
+	var excluded strings.Builder
+	var changed []FilePatch
+	for _, p := range patches {
+		if p.Excluded {
+			excluded.WriteString(p.Patch)
+			continue
+		}
+		changed = append(changed, p)
+		report.Omitted = append(report.Omitted, p.Path)
+	}
+
+	sort.Strings(report.Excluded)
+	sort.Strings(report.Omitted)
+
+	return excluded.String() + diffstatSummary(changed, budget, counter), report
+}
+
+func removeString(list []string, s string) []string {
+	var kept []string
+	for _, v := range list {
+		if v != s {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+// truncatePatch drops whole hunks until the patch fits into maxTokens,
+// keeping the header, then the first and last hunks, then as many of the
+// others in order as fit. Gaps are marked with the number of hunks left
+// out. Only when not even the first hunk fits is it cut line by line.
+func truncatePatch(patch string, maxTokens int, counter *TokenCounter) string {
+	header, hunks := splitHunks(patch)
+	if len(hunks) == 0 {
+		return truncateLines(patch, maxTokens, counter)
+	}
+
+	used := counter.Count(header)
+	costs := make([]int, len(hunks))
+	for i, h := range hunks {
+		costs[i] = counter.Count(firstBytes(h, maxTokens*maxBytesPerToken))
+	}
+
+	const markerCost = 16 // Tokens reserved for each omission marker
+	kept := make([]bool, len(hunks))
+	order := []int{0}
+	if len(hunks) > 1 {
+		order = append(order, len(hunks)-1)
+	}
+	for i := 1; i < len(hunks)-1; i++ {
+		order = append(order, i)
+	}
+	for _, i := range order {
+		if used+costs[i]+2*markerCost <= maxTokens {
+			kept[i] = true
+			used += costs[i]
+		}
+	}
+
+	if !slices.Contains(kept, true) {
+		marker := "... (hunk truncated) ...\n"
+		if len(hunks) > 1 {
+			marker = fmt.Sprintf("... (hunk truncated, %d hunk(s) omitted) ...\n", len(hunks)-1)
+		}
+		return header + truncateLines(hunks[0], maxTokens-counter.Count(header)-counter.Count(marker), counter) + marker
+	}
+
+	var truncated strings.Builder
+	truncated.WriteString(header)
+	omitted := 0
+	for i, h := range hunks {
+		if !kept[i] {
+			omitted++
+			continue
+		}
+		if omitted > 0 {
+			truncated.WriteString(fmt.Sprintf("... (%d hunk(s) omitted) ...\n", omitted))
+			omitted = 0
+		}
+		truncated.WriteString(h)
+	}
+	if omitted > 0 {
+		truncated.WriteString(fmt.Sprintf("... (%d hunk(s) omitted) ...\n", omitted))
+	}
+
+	return truncated.String()
+}
+
+// truncateLines keeps as many whole lines as fit into maxTokens, always
+// including the first four, which hold the diff header.
+func truncateLines(patch string, maxTokens int, counter *TokenCounter) string {
+	lines := strings.SplitAfter(patch, "\n")
+	var truncated strings.Builder
+	var used int
+
+	for i, line := range lines {
+		cost := counter.Count(line)
+		if i >= 4 && used+cost > maxTokens {
+			break
+		}
+		truncated.WriteString(line)
+		used += cost
+	}
+
+	return truncated.String()
+}
+
+func firstBytes(s string, n int) string {
+	if n > 0 && len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testPatch returns a patch of path with one hunk per entry of hunkLines,
+// each adding that many lines.
+func testPatch(path string, hunkLines ...int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "diff --git a/%s b/%s\n--- a/%s\n+++ b/%s\n", path, path, path, path)
+	for h, n := range hunkLines {
+		fmt.Fprintf(&b, "@@ -%d,0 +%d,%d @@\n", h*100, h*100, n)
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(&b, "+hunk %d line %d of the change\n", h, i)
+		}
+	}
+	return b.String()
+}
+
+func TestFitPatches(t *testing.T) {
+	counter, err := newTokenCounter("llama3-70b-8192")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := FilePatch{Path: "cache.go", Patch: testPatch("cache.go", 20)}
+	docs := FilePatch{Path: "README.md", Patch: testPatch("README.md", 20)}
+	largeDocs := FilePatch{Path: "README.md", Patch: testPatch("README.md", 200)}
+	large := FilePatch{Path: "main.go", Patch: testPatch("main.go", 40, 40, 40)}
+	excluded := excludedPatch("logo.png")
+
+	tests := []struct {
+		name     string
+		patches  []FilePatch
+		budget   int
+		want     DiffReport
+		contains []string
+	}{
+		{
+			name:     "everything fits",
+			patches:  []FilePatch{docs, source, excluded},
+			budget:   4000,
+			want:     DiffReport{Excluded: []string{"logo.png"}},
+			contains: []string{docs.Patch + source.Patch + excluded.Patch},
+		},
+		{
+			name:     "docs are left to the diffstat",
+			patches:  []FilePatch{docs, source},
+			budget:   counter.Count(source.Patch) + 50,
+			want:     DiffReport{Omitted: []string{"README.md"}},
+			contains: []string{source.Patch, omittedHeader + " README.md | +20 -0\n"},
+		},
+		{
+			name:     "the most relevant file is truncated",
+			patches:  []FilePatch{largeDocs, large},
+			budget:   counter.Count(large.Patch) / 2,
+			want:     DiffReport{Truncated: []string{"main.go"}, Omitted: []string{"README.md"}},
+			contains: []string{"hunk 0 line 39 ", "hunk(s) omitted) ...\n", omittedHeader + " README.md | +200 -0\n"},
+		},
+		{
+			name:     "only a summary fits",
+			patches:  []FilePatch{source, docs, excluded},
+			budget:   40,
+			want:     DiffReport{Excluded: []string{"logo.png"}, Omitted: []string{"README.md", "cache.go"}},
+			contains: []string{excluded.Patch, "Diff too large to include; summary of the changes:\n 2 files changed, 40 insertions(+), 0 deletions(-)\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff, report := fitPatches(tt.patches, tt.budget, counter)
+			if !slices.Equal(report.Excluded, tt.want.Excluded) || !slices.Equal(report.Truncated, tt.want.Truncated) || !slices.Equal(report.Omitted, tt.want.Omitted) {
+				t.Errorf("report %+v, want %+v", report, tt.want)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(diff, s) {
+					t.Errorf("diff does not contain %q:\n%s", s, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestTruncatePatch(t *testing.T) {
+	counter, err := newTokenCounter("gpt-4o-mini-2024-07-18")
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := "diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n"
+
+	tests := []struct {
+		name      string
+		patch     string
+		maxTokens int
+		contains  []string
+		excludes  []string
+	}{
+		{
+			name:      "fits",
+			patch:     testPatch("main.go", 5, 5),
+			maxTokens: 1000,
+			contains:  []string{testPatch("main.go", 5, 5)},
+			excludes:  []string{"omitted"},
+		},
+		{
+			name:      "first and last hunks are kept",
+			patch:     testPatch("main.go", 10, 10, 10, 10),
+			maxTokens: counter.Count(testPatch("main.go", 10, 10)) + 40,
+			contains:  []string{header, "hunk 0 line 9 ", "... (2 hunk(s) omitted) ...\n", "hunk 3 line 9 "},
+			excludes:  []string{"hunk 1 ", "hunk 2 "},
+		},
+		{
+			name:      "a hunk too large is cut by lines",
+			patch:     testPatch("main.go", 200, 10),
+			maxTokens: 100,
+			contains:  []string{header, "hunk 0 line 0 ", "... (hunk truncated, 1 hunk(s) omitted) ...\n"},
+			excludes:  []string{"hunk 0 line 199 ", "hunk 1 "},
+		},
+		{
+			name:      "no hunks",
+			patch:     "Submodule vendor/lib 1234567..89abcde:\n" + strings.Repeat("  > Update the dependency\n", 100),
+			maxTokens: 50,
+			contains:  []string{"Submodule vendor/lib", "  > Update the dependency\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncatePatch(tt.patch, tt.maxTokens, counter)
+			if n := counter.Count(got); n > tt.maxTokens {
+				t.Errorf("%d tokens, want at most %d", n, tt.maxTokens)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(got, s) {
+					t.Errorf("result does not contain %q:\n%s", s, got)
+				}
+			}
+			for _, s := range tt.excludes {
+				if strings.Contains(got, s) {
+					t.Errorf("result contains %q:\n%s", s, got)
+				}
+			}
+		})
+	}
+}
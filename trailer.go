@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5/config"
+)
+
+// trailerLine matches a git trailer such as "Signed-off-by: A <a@b.c>".
+var trailerLine = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*: \S`)
+
+// identity matches "Name <email>".
+var identity = regexp.MustCompile(`^[^<>]+ <[^<>\s]+@[^<>\s]+>$`)
+
+// Trailer is a "Key: Value" line at the end of a commit message.
+type Trailer struct {
+	Key   string
+	Value string
+}
+
+func (t Trailer) String() string {
+	return t.Key + ": " + t.Value
+}
+
+// parseTrailer accepts KEY=VALUE or "KEY: VALUE", like git commit --trailer.
+func parseTrailer(value string) (Trailer, error) {
+	key, v, ok := strings.Cut(value, "=")
+	if i := strings.Index(value, ":"); i >= 0 && (!ok || i < len(key)) {
+		key, v, ok = value[:i], value[i+1:], true
+	}
+	t := Trailer{Key: strings.TrimSpace(key), Value: strings.TrimSpace(v)}
+	if !ok || t.Key == "" || t.Value == "" || strings.ContainsAny(t.Key, " \t") {
+		return Trailer{}, fmt.Errorf("want KEY=VALUE or KEY: VALUE, got %q", value)
+	}
+	return t, nil
+}
+
+// trailerFlag collects repeated -trailer values. Values are not split at
+// commas, which are common in trailer values.
+type trailerFlag []Trailer
+
+func (f *trailerFlag) String() string {
+	var parts []string
+	for _, t := range *f {
+		parts = append(parts, t.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (f *trailerFlag) Type() string {
+	return "trailer"
+}
+
+func (f *trailerFlag) Set(value string) error {
+	t, err := parseTrailer(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, t)
+	return nil
+}
+
+// coAuthorFlag adds a Co-authored-by trailer for each -co-author.
+type coAuthorFlag []Trailer
+
+func (f *coAuthorFlag) String() string {
+	return (*trailerFlag)(f).String()
+}
+
+func (f *coAuthorFlag) Type() string {
+	return "identity"
+}
+
+func (f *coAuthorFlag) Set(value string) error {
+	value = strings.TrimSpace(value)
+	if !identity.MatchString(value) {
+		return fmt.Errorf("want \"Name <email>\", got %q", value)
+	}
+	*f = append(*f, Trailer{Key: "Co-authored-by", Value: value})
+	return nil
+}
+
+// signoffTrailer returns the Signed-off-by trailer git commit -s would add,
+// taken from GIT_COMMITTER_NAME/EMAIL or user.name/email.
+func (g *CommitMessageGenerator) signoffTrailer() (Trailer, error) {
+	name, email := os.Getenv("GIT_COMMITTER_NAME"), os.Getenv("GIT_COMMITTER_EMAIL")
+	if g.repo != nil && (name == "" || email == "") {
+		cfg, err := g.repo.ConfigScoped(config.GlobalScope)
+		if err != nil {
+			return Trailer{}, fmt.Errorf("reading git config: %w", err)
+		}
+		if name == "" {
+			name = cfg.User.Name
+		}
+		if email == "" {
+			email = cfg.User.Email
+		}
+	}
+	if name == "" || email == "" {
+		return Trailer{}, fmt.Errorf("-signoff needs user.name and user.email in git config")
+	}
+	return Trailer{Key: "Signed-off-by", Value: fmt.Sprintf("%s <%s>", name, email)}, nil
+}
+
+// splitTrailers separates the trailer block ending message, a last
+// paragraph made only of trailers, from the rest.
+func splitTrailers(message string) (string, string) {
+	message = strings.TrimRight(message, "\n")
+	i := strings.LastIndex(message, "\n\n")
+	if i < 0 {
+		return message, ""
+	}
+	for _, line := range strings.Split(message[i+2:], "\n") {
+		if !trailerLine.MatchString(line) {
+			return message, ""
+		}
+	}
+	return strings.TrimRight(message[:i], "\n"), message[i+2:]
+}
+
+// appendTrailers adds trailers to the trailer block at the end of message,
+// starting one after a blank line if there is none. Trailers already
+// present are not repeated.
+func appendTrailers(message string, trailers []Trailer) string {
+	if len(trailers) == 0 {
+		return message
+	}
+	message = strings.TrimRight(message, "\n")
+
+	_, block := splitTrailers(message)
+	existing := map[string]bool{}
+	for _, line := range strings.Split(block, "\n") {
+		existing[strings.ToLower(line)] = true
+	}
+
+	var added []string
+	for _, t := range trailers {
+		line := t.String()
+		if !existing[strings.ToLower(line)] {
+			added = append(added, line)
+			existing[strings.ToLower(line)] = true
+		}
+	}
+	if len(added) == 0 {
+		return message
+	}
+	if block != "" {
+		return message + "\n" + strings.Join(added, "\n")
+	}
+	return message + "\n\n" + strings.Join(added, "\n")
+}
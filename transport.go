@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// newTransport returns the transport shared by every request to a
+// provider. Without -proxy, HTTPS_PROXY, HTTP_PROXY and NO_PROXY decide
+// whether a proxy is used; -ca-cert adds the CA of a TLS-intercepting
+// proxy to the system roots, and -insecure stops verifying certificates.
+func newTransport(options Options) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if options.LocalOnly {
+		if options.Proxy != "" {
+			return nil, fmt.Errorf("-local-only cannot be combined with -proxy")
+		}
+		// A proxy would forward the request off the machine.
+		transport.Proxy = nil
+		transport.DialContext = localOnlyDial((&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext)
+	}
+
+	if options.Proxy != "" {
+		proxy, err := url.Parse(options.Proxy)
+		if err != nil || proxy.Host == "" {
+			return nil, fmt.Errorf("invalid -proxy %q: want a URL such as http://proxy.example.com:8080", options.Proxy)
+		}
+		switch proxy.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("invalid -proxy %q: the scheme must be http, https or socks5", options.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if options.CACert == "" && !options.Insecure {
+		return transport, nil
+	}
+	config := &tls.Config{InsecureSkipVerify: options.Insecure}
+	if options.CACert != "" {
+		pem, err := os.ReadFile(options.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("reading -ca-cert: %w", err)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("-ca-cert %s holds no PEM certificates", options.CACert)
+		}
+		config.RootCAs = roots
+	}
+	transport.TLSClientConfig = config
+	return transport, nil
+}
+
+// httpClient returns a client for provider requests that goes through the
+// shared transport.
+func (o Options) httpClient() *http.Client {
+	client := &http.Client{Timeout: o.Timeout}
+	if o.transport != nil {
+		client.Transport = o.transport
+	}
+	return client
+}
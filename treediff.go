@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+)
+
+// getTreeDiff builds patches for the changes between two tree-ish
+// revisions. It only reads objects, so it works on bare repositories.
+func (g *CommitMessageGenerator) getTreeDiff(base string, head string) ([]FilePatch, error) {
+	baseTree, err := g.resolveTree(base)
+	if err != nil {
+		return nil, err
+	}
+	headTree, err := g.resolveTree(head)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := object.DiffTreeWithOptions(context.Background(), baseTree, headTree, object.DefaultDiffTreeOptions)
+	if err != nil {
+		return nil, fmt.Errorf("diffing %s and %s: %w", base, head, err)
+	}
+
+	var selected []fileChange
+	for _, change := range changes {
+		if !g.pathspec.Match(change.From.Name, change.To.Name) {
+			continue
+		}
+		c, err := treeChange(change)
+		if err != nil {
+			return nil, fmt.Errorf("generating patch for %s: %w", changePath(change), err)
+		}
+		selected = append(selected, c)
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].Path < selected[j].Path })
+
+	return g.renderChanges(selected)
+}
+
+// resolveTree resolves a commit, tag or tree revision to its tree.
+func (g *CommitMessageGenerator) resolveTree(rev string) (*object.Tree, error) {
+	hash, err := g.repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", rev, err)
+	}
+
+	obj, err := g.repo.Object(plumbing.AnyObject, *hash)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", rev, err)
+	}
+
+	for {
+		switch o := obj.(type) {
+		case *object.Tree:
+			return o, nil
+		case *object.Commit:
+			return o.Tree()
+		case *object.Tag:
+			obj, err = o.Object()
+			if err != nil {
+				return nil, fmt.Errorf("peeling tag %s: %w", rev, err)
+			}
+		default:
+			return nil, fmt.Errorf("%s is not a tree-ish", rev)
+		}
+	}
+}
+
+// treeChange describes a change between two trees for renderChange.
+func treeChange(change *object.Change) (fileChange, error) {
+	action, err := change.Action()
+	if err != nil {
+		return fileChange{}, err
+	}
+
+	c := fileChange{
+		Path:    changePath(change),
+		OldHash: change.From.TreeEntry.Hash,
+		NewHash: change.To.TreeEntry.Hash,
+		OldMode: change.From.TreeEntry.Mode,
+		NewMode: change.To.TreeEntry.Mode,
+	}
+	switch {
+	case action == merkletrie.Insert:
+		c.Action = git.Added
+	case action == merkletrie.Delete:
+		c.Action = git.Deleted
+	case change.From.Name != change.To.Name:
+		c.Action, c.OldPath = git.Renamed, change.From.Name
+	default:
+		c.Action = git.Modified
+	}
+	return c, nil
+}
+
+func changePath(change *object.Change) string {
+	if change.To.Name != "" {
+		return change.To.Name
+	}
+	return change.From.Name
+}
@@ -0,0 +1,40 @@
+package main
+
+import "strings"
+
+const onelinePrompt = `
+
+# 長さ
+
+コミットメッセージは件名の1行だけを出力し、本文は書かないこと。この指定はこれまでの条件より優先する。
+`
+
+const detailedPrompt = `
+
+# 長さ
+
+コミットメッセージは次の形式で書くこと。この指定はこれまでの条件より優先する。
+
+- 1行目は変更を要約した件名
+- 2行目は空行
+- 3行目からは変更点を「- 」で始まる箇条書きで列挙する
+- 箇条書きの後に空行を挟み、変更の理由（なぜ必要か、他の方法を選ばなかったのはなぜか）を短い段落で書く
+`
+
+// verbosityContext fixes the length and layout of the message for
+// -oneline and -detailed.
+func (o Options) verbosityContext() string {
+	switch {
+	case o.Oneline:
+		return onelinePrompt
+	case o.Detailed:
+		return detailedPrompt
+	}
+	return ""
+}
+
+// subjectLine drops everything after the first line of message.
+func subjectLine(message string) string {
+	subject, _, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	return strings.TrimSpace(subject)
+}
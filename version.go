@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build metadata, set with
+//
+//	go build -ldflags "-X main.version=v1.2.3 -X main.commit=$(git rev-parse HEAD) -X main.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Builds without them fall back to what the Go toolchain recorded.
+var (
+	version = ""
+	commit  = ""
+	date    = ""
+)
+
+// buildVersion returns the version, commit and build date, filling in what
+// ldflags did not set from the module version and VCS stamp of the build.
+func buildVersion() (string, string, string) {
+	v, c, d := version, commit, date
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if v == "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			v = info.Main.Version // go install ...@v1.2.3
+		}
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && c == "":
+				c = setting.Value
+			case setting.Key == "vcs.time" && d == "":
+				d = setting.Value
+			}
+		}
+	}
+	if v == "" {
+		v = "dev"
+	}
+	return v, c, d
+}
+
+// printVersion writes the -version line.
+func printVersion(w io.Writer) {
+	v, c, d := buildVersion()
+	if len(c) > 12 {
+		c = c[:12]
+	}
+	if c == "" {
+		c = "unknown"
+	}
+	if d == "" {
+		d = "unknown"
+	}
+	fmt.Fprintf(w, "autogcm %s (commit %s, built %s, %s %s/%s)\n", v, c, d, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+)
+
+// worktreeEntry returns the state of an indexed file in the worktree, for
+// -all. The second result is false when the file was removed from the
+// worktree. Changed content is kept in memory rather than written to the
+// object database, so getBlobContent can serve it without touching .git.
+func (g *CommitMessageGenerator) worktreeEntry(entry *index.Entry) (treeEntry, bool, error) {
+	indexed := treeEntry{Hash: entry.Hash, Mode: entry.Mode}
+	if entry.Mode == filemode.Submodule || entry.SkipWorktree || g.worktree == nil {
+		return indexed, true, nil
+	}
+
+	fs := g.worktree.Filesystem
+	fi, err := fs.Lstat(entry.Name)
+	if errors.Is(err, os.ErrNotExist) {
+		return treeEntry{}, false, nil
+	}
+	if err != nil {
+		return treeEntry{}, false, fmt.Errorf("reading %s: %w", entry.Name, err)
+	}
+
+	mode, err := filemode.NewFromOSFileMode(fi.Mode())
+	if err != nil {
+		return indexed, true, nil // Not something git tracks, e.g. a directory
+	}
+
+	// Same shortcut as git: an unchanged size and mtime means unchanged content.
+	if mode == entry.Mode && fi.Size() == int64(entry.Size) && fi.ModTime().Equal(entry.ModifiedAt) {
+		return indexed, true, nil
+	}
+
+	var content []byte
+	if mode == filemode.Symlink {
+		target, err := fs.Readlink(entry.Name)
+		if err != nil {
+			return treeEntry{}, false, fmt.Errorf("reading link %s: %w", entry.Name, err)
+		}
+		content = []byte(target)
+	} else {
+		f, err := fs.Open(entry.Name)
+		if err != nil {
+			return treeEntry{}, false, fmt.Errorf("opening %s: %w", entry.Name, err)
+		}
+		defer f.Close()
+		if content, err = io.ReadAll(f); err != nil {
+			return treeEntry{}, false, fmt.Errorf("reading %s: %w", entry.Name, err)
+		}
+	}
+
+	hash := plumbing.ComputeHash(plumbing.BlobObject, content)
+	if hash != entry.Hash {
+		if g.worktreeBlobs == nil {
+			g.worktreeBlobs = map[plumbing.Hash]string{}
+		}
+		g.worktreeBlobs[hash] = string(content)
+	}
+
+	return treeEntry{Hash: hash, Mode: mode}, true, nil
+}